@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -11,7 +12,15 @@ import (
 	"github.com-Personal/go-fiber/config/firebase_config"
 	"github.com-Personal/go-fiber/internal/database"
 	"github.com-Personal/go-fiber/internal/handlers"
+	"github.com-Personal/go-fiber/internal/loginguard"
+	"github.com-Personal/go-fiber/internal/mailer"
 	"github.com-Personal/go-fiber/internal/middleware"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com-Personal/go-fiber/internal/relme"
+	"github.com-Personal/go-fiber/internal/scheduler"
+	"github.com-Personal/go-fiber/internal/sso"
+	"github.com-Personal/go-fiber/internal/utils"
+	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 )
@@ -29,47 +38,139 @@ func main() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
+	// Background jobs run until shutdown
+	stopBackgroundJobs := make(chan struct{})
+
+	// Initialize token signing keys
+	var keyRing *utils.KeyRing
+	if cfg.JWTSigningAlg != "HS256" {
+		keyRing, err = utils.NewKeyRing(db, cfg.JWTSigningAlg, cfg.JWTKeyRotation, cfg.JWTKeyRetention)
+		if err != nil {
+			log.Fatalf("Failed to initialize signing keys: %v", err)
+		}
+		utils.SetKeyRing(keyRing)
+		keyRing.Start(stopBackgroundJobs)
+	}
+
+	// Publish scheduled posts
+	scheduler.NewPostPublisher(db, cfg.PostSchedulerInterval).Start(stopBackgroundJobs)
+
 	// Initialize Firebase
-	_, _, err = firebase_config.InitializeFirebaseApp()
+	firebaseAuth, _, err := firebase_config.InitializeFirebaseApp()
 	if err != nil {
 		log.Fatalf("Error initializing Firebase: %v", err)
 	}
 	fmt.Println("Firebase Auth client initialized successfully.")
 
 	// Initialize Fiber router
-	router := fiber.New()
+	// Behind a reverse proxy the client IP, which login throttling counts
+	// failures by, comes from PROXY_HEADER on requests from a trusted proxy.
+	router := fiber.New(fiber.Config{
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: cfg.ProxyHeader != "",
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
+	})
 	router.Use(middleware.CorsMiddleware())
 	router.Use(logger.New())
 
 	// Health check routes
 	router.Use(middleware.HealthCheckMiddleware())
 
+	// Initialize login throttling
+	var attemptStore loginguard.Store = loginguard.NewMemoryStore()
+	if cfg.LoginAttemptStore == "database" {
+		attemptStore = loginguard.NewDBStore(db)
+	}
+	guardConfig := loginguard.DefaultConfig()
+	guardConfig.MaxFailures = cfg.LoginMaxFailures
+	guardConfig.IPMaxFailures = cfg.LoginIPMaxFailures
+	guardConfig.LockoutDuration = cfg.LoginLockoutDuration
+	guard := loginguard.New(attemptStore, guardConfig)
+
+	// Initialize OpenID Connect providers
+	var ssoProviders []*sso.Provider
+	for _, providerConfig := range cfg.OIDCProviders {
+		provider, err := sso.NewProvider(context.Background(), providerConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize login provider: %v", err)
+		}
+		ssoProviders = append(ssoProviders, provider)
+	}
+
+	// Initialize email delivery
+	mail, err := mailer.New()
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(db)
+	userHandler := handlers.NewUserHandler(db, mail, guard, cfg.AppBaseURL)
+	firebaseAuthHandler := handlers.NewFirebaseAuthHandler(userHandler, firebase_utils.NewAuthClientVerifier(firebaseAuth))
+	ssoHandler := handlers.NewSSOHandler(userHandler, ssoProviders)
+	profileHandler := handlers.NewProfileHandler(userHandler, relme.NewHTTPFetcher())
 	postHandler := handlers.NewPostHandler(db)
 	commentHandler := handlers.NewCommentHandler(db)
 	likes_and_dislikes := handlers.NewLikesandDislikes(db)
 	bookmarkHandler := handlers.NewBookmarkHandler(db)
 	contactHandler := handlers.NewContactHandlers(db)
+	jwksHandler := handlers.NewJWKSHandler(keyRing)
 
 	// Public routes
+	router.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
 	router.Post("/login", userHandler.Login)
+	router.Post("/login/mfa", userHandler.VerifyLoginMFA)
+	router.Post("/login/firebase", firebaseAuthHandler.Login)
 	router.Post("/register", userHandler.Register)
 	router.Post("/refresh", userHandler.RefreshToken)
 	router.Post("/logout", userHandler.Logout)
-	router.Get("/verifyemail/:email", userHandler.CheckEmail)
-	router.Put("/reset-password", userHandler.ForgotPassword)
+	router.Get("/verify-email", userHandler.VerifyEmail)
+	router.Post("/verify-email/resend", userHandler.ResendVerificationEmail)
+	router.Post("/forgot-password", userHandler.RequestPasswordReset)
+	router.Post("/reset-password", userHandler.ResetPassword)
+	router.Get("/unlock-account", userHandler.UnlockAccount)
+	router.Get("/auth/providers", ssoHandler.GetProviders)
+	router.Get("/auth/:provider", ssoHandler.Login)
+	router.Get("/auth/:provider/callback", ssoHandler.Callback)
 
 	// Protected routes group
-	api := router.Group("/", middleware.AuthMiddleware())
+	api := router.Group("/", middleware.AuthMiddleware(db))
 
 	// User routes
 	users := api.Group("/users")
 	users.Get("", userHandler.GetProfile)
 	users.Get("/:username", userHandler.GetUserDetail)
 	users.Get("/uploads/avatars/:filename", userHandler.GetAvatarImage)
-	users.Put("/:id", userHandler.UpdateProfile)
-	users.Post("/:id/avatar", userHandler.UploadAvatar)
+	users.Put("/me/password", userHandler.ChangePassword)
+	users.Post("/me/2fa/enroll", userHandler.EnrollTOTP)
+	users.Post("/me/2fa/confirm", userHandler.ConfirmTOTP)
+	users.Delete("/me/2fa", userHandler.DisableTOTP)
+	users.Put("/me", userHandler.UpdateProfile)
+	users.Delete("/me", userHandler.DeleteAccount)
+	users.Post("/me/exports", userHandler.RequestExport)
+	users.Get("/me/exports/:id", userHandler.GetExport)
+	users.Get("/me/exports/:id/download", userHandler.DownloadExport)
+	users.Get("/me/tokens", userHandler.GetPersonalAccessTokens)
+	users.Post("/me/tokens", userHandler.CreatePersonalAccessToken)
+	users.Delete("/me/tokens/:id", userHandler.RevokePersonalAccessToken)
+	users.Get("/me/sessions", userHandler.GetSessions)
+	users.Delete("/me/sessions", userHandler.RevokeAllSessions)
+	users.Delete("/me/sessions/:id", userHandler.RevokeSession)
+	users.Get("/me/identities", ssoHandler.GetIdentities)
+	users.Post("/me/identities/:provider", ssoHandler.Link)
+	users.Delete("/me/identities/:id", ssoHandler.Unlink)
+	users.Post("/me/avatar", userHandler.UploadAvatar)
+	users.Post("/me/cover", userHandler.UploadCoverImage)
+	users.Post("/me/social-links/:id/verify", profileHandler.VerifySocialLink)
+	users.Get("/me/follow-requests", userHandler.GetFollowRequests)
+	users.Post("/me/follow-requests/:id/approve", userHandler.ApproveFollowRequest)
+	users.Delete("/me/follow-requests/:id", userHandler.RejectFollowRequest)
+	users.Get("/me/blocks", userHandler.GetBlockedUsers)
+	users.Get("/me/mutes", userHandler.GetMutedUsers)
+	users.Post("/:id/block", userHandler.BlockUser)
+	users.Delete("/:id/block", userHandler.UnblockUser)
+	users.Post("/:id/mute", userHandler.MuteUser)
+	users.Delete("/:id/mute", userHandler.UnmuteUser)
 	users.Post("/follow/:followingID", userHandler.FollowUser)
 	users.Delete("/unfollow/:followingID", userHandler.UnfollowUser)
 	users.Get("/:id/followers", userHandler.GetFollowers)
@@ -82,7 +183,7 @@ func main() {
 	api.Get("/posts/:post_id/reactions", likes_and_dislikes.GetReaction)
 
 	// Comment routes
-	api.Post("/posts/:id/comments", commentHandler.AddComment)
+	api.Post("/posts/:id/comments", middleware.RequireVerifiedEmail(db), middleware.RequirePermission(db, policy.CommentsCreate), commentHandler.AddComment)
 	api.Get("/posts/:id/comments", commentHandler.GetCommentsandCount)
 	api.Put("/comments/:id", commentHandler.UpdateComment)
 	api.Delete("/comments/:id", commentHandler.DeleteComment)
@@ -90,16 +191,29 @@ func main() {
 	// Post routes
 	api.Get("/posts", postHandler.GetPosts)
 	api.Get("/uploads/:filename", postHandler.GetImage)
-	api.Post("/posts", postHandler.NewPost)
+	api.Post("/posts", middleware.RequireVerifiedEmail(db), middleware.RequirePermission(db, policy.PostsCreate), postHandler.NewPost)
 	api.Get("posts/:username/:slug", postHandler.GetPostBySlug)
 	api.Put("/posts/:id", postHandler.UpdatePost)
 	api.Delete("/posts/:id", postHandler.DeletePost)
+	api.Post("/posts/:id/publish", postHandler.PublishPost)
+	api.Post("/posts/:id/unpublish", postHandler.UnpublishPost)
+	api.Post("/posts/:id/schedule", postHandler.SchedulePost)
+	api.Post("/posts/:id/archive", postHandler.ArchivePost)
+	api.Get("/posts/:id/revisions", postHandler.GetRevisions)
+	api.Get("/posts/:id/revisions/diff", postHandler.DiffRevisions)
+	api.Get("/posts/:id/revisions/:number", postHandler.GetRevision)
+	api.Post("/posts/:id/revisions/:number/restore", postHandler.RestoreRevision)
 	api.Get("/users/:id/posts", postHandler.GetPostsByUser)
+	api.Get("/search", postHandler.Search)
 
 	api.Post("/users/:post_id/bookmark", bookmarkHandler.BookmarkPost)
 	api.Get("/users/post/bookmarks", bookmarkHandler.GetBookmarks)
 	api.Get("/:post_id/bookmarkscount", bookmarkHandler.GetBookmarkCount)
 
+	// Admin routes
+	admin := api.Group("/admin", middleware.RequirePermission(db, policy.UsersManage))
+	admin.Put("/users/:id/role", userHandler.UpdateUserRole)
+
 	// Contact routes
 	api.Post("/contact-us", contactHandler.PostContact)
 
@@ -116,6 +230,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down the server...")
+	close(stopBackgroundJobs)
 
 	// Shutdown the server
 	if err := router.Shutdown(); err != nil {
@@ -2,9 +2,16 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com-Personal/go-fiber/internal/sso"
 	"github.com-Personal/go-fiber/internal/utils"
 	"github.com/joho/godotenv"
 )
@@ -13,6 +20,30 @@ type Config struct {
 	DatabaseURL string
 	PORT        string
 	HOST        string
+
+	// AppBaseURL is the public address of the app, without a trailing
+	// slash. Links in emails, OpenID Connect redirect URIs and the profile
+	// URLs rel="me" links have to point at are built from it, never from the
+	// request's Host header.
+	AppBaseURL string
+
+	// ProxyHeader names the header a reverse proxy puts the client IP in.
+	// It is only believed on requests from TrustedProxies.
+	ProxyHeader    string
+	TrustedProxies []string
+
+	JWTSigningAlg   string
+	JWTKeyRotation  time.Duration
+	JWTKeyRetention time.Duration
+
+	LoginAttemptStore    string
+	LoginMaxFailures     int
+	LoginIPMaxFailures   int
+	LoginLockoutDuration time.Duration
+
+	PostSchedulerInterval time.Duration
+
+	OIDCProviders []sso.Config
 }
 
 // Load will load configuration from .env and Docker secrets.
@@ -32,13 +63,160 @@ func Load() (*Config, error) {
 		return nil, errors.New("DATABASE_URL is not set")
 	}
 
+	appBaseURL, err := parseBaseURL(utils.GetSecretOrEnv("APP_BASE_URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	proxyHeader := getEnv("PROXY_HEADER", "")
+	trustedProxies, err := parseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		return nil, err
+	}
+	if proxyHeader != "" && len(trustedProxies) == 0 {
+		return nil, errors.New("TRUSTED_PROXIES is required when PROXY_HEADER is set")
+	}
+
+	keyRotation, err := time.ParseDuration(getEnv("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL: %w", err)
+	}
+
+	keyRetention, err := time.ParseDuration(getEnv("JWT_KEY_RETENTION", "192h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_RETENTION: %w", err)
+	}
+
+	// A key signs until the key after it takes over, which happens up to a
+	// rotation check after it is generated plus the time it spends only
+	// being published. Every token signed until then has to stay
+	// verifiable until it expires.
+	signingAlg := getEnv("JWT_SIGNING_ALG", "HS256")
+	if signingAlg != "HS256" {
+		if keyRotation <= 0 {
+			return nil, errors.New("JWT_KEY_ROTATION_INTERVAL must be positive")
+		}
+		minRetention := utils.RefreshTokenTTL + utils.RotationCheckInterval(keyRotation) + utils.JWKSMaxAge
+		if keyRetention < minRetention {
+			return nil, fmt.Errorf("JWT_KEY_RETENTION must be at least %s, the refresh token lifetime plus how late a key can be replaced", minRetention)
+		}
+	}
+
+	loginMaxFailures, err := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES: %w", err)
+	}
+
+	loginIPMaxFailures, err := strconv.Atoi(getEnv("LOGIN_IP_MAX_FAILURES", "50"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_IP_MAX_FAILURES: %w", err)
+	}
+
+	loginLockout, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION: %w", err)
+	}
+
+	postSchedulerInterval, err := time.ParseDuration(getEnv("POST_SCHEDULER_INTERVAL", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid POST_SCHEDULER_INTERVAL: %w", err)
+	}
+	if postSchedulerInterval <= 0 {
+		return nil, errors.New("POST_SCHEDULER_INTERVAL must be positive")
+	}
+
+	oidcProviders, err := loadOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		DatabaseURL: databaseUrl,
 		PORT:        port,
 		HOST:        host,
+
+		AppBaseURL: appBaseURL,
+
+		ProxyHeader:    proxyHeader,
+		TrustedProxies: trustedProxies,
+
+		JWTSigningAlg:   signingAlg,
+		JWTKeyRotation:  keyRotation,
+		JWTKeyRetention: keyRetention,
+
+		LoginAttemptStore:    getEnv("LOGIN_ATTEMPT_STORE", "memory"),
+		LoginMaxFailures:     loginMaxFailures,
+		LoginIPMaxFailures:   loginIPMaxFailures,
+		LoginLockoutDuration: loginLockout,
+
+		PostSchedulerInterval: postSchedulerInterval,
+
+		OIDCProviders: oidcProviders,
 	}, nil
 }
 
+// parseBaseURL checks that APP_BASE_URL is an absolute http or https URL
+// and drops any trailing slash.
+func parseBaseURL(raw string) (string, error) {
+	if raw == "" {
+		return "", errors.New("APP_BASE_URL is not set")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid APP_BASE_URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", errors.New("invalid APP_BASE_URL: must be an http or https URL without a query or fragment")
+	}
+	return strings.TrimSuffix(raw, "/"), nil
+}
+
+// parseTrustedProxies reads the comma separated IP addresses and CIDR ranges
+// in TRUSTED_PROXIES.
+func parseTrustedProxies(raw string) ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(raw, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: must be an IP address or CIDR range", proxy)
+			}
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS. Each name is
+// configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and an
+// optional space separated _SCOPES.
+func loadOIDCProviders() ([]sso.Config, error) {
+	var providers []sso.Config
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := sso.Config{
+			Name:         name,
+			Issuer:       utils.GetSecretOrEnv(prefix + "ISSUER"),
+			ClientID:     utils.GetSecretOrEnv(prefix + "CLIENT_ID"),
+			ClientSecret: utils.GetSecretOrEnv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
 // getEnv fetches environment variables with a fallback
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadValidatesKeyRetention(t *testing.T) {
+	tests := []struct {
+		alg, rotation, retention string
+		wantErr                  bool
+	}{
+		{"RS256", "720h", "192h", false},
+		{"RS256", "720h", "168h", true},
+		{"EdDSA", "2h", "168h30m", false},
+		{"EdDSA", "2h", "168h", true},
+		{"HS256", "720h", "1h", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DATABASE_URL", "postgres://localhost/blog")
+		t.Setenv("APP_BASE_URL", "https://blog.example")
+		t.Setenv("JWT_SIGNING_ALG", tt.alg)
+		t.Setenv("JWT_KEY_ROTATION_INTERVAL", tt.rotation)
+		t.Setenv("JWT_KEY_RETENTION", tt.retention)
+
+		_, err := Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s rotating every %s, retention %s: err = %v, want error %v", tt.alg, tt.rotation, tt.retention, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "JWT_KEY_RETENTION") {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestLoadRequiresBaseURL(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/blog")
+
+	for _, raw := range []string{"", "blog.example", "ftp://blog.example", "https://blog.example/?next=1", "/relative"} {
+		t.Setenv("APP_BASE_URL", raw)
+		if _, err := Load(); err == nil {
+			t.Errorf("APP_BASE_URL=%q was accepted", raw)
+		}
+	}
+
+	t.Setenv("APP_BASE_URL", "https://blog.example/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AppBaseURL != "https://blog.example" {
+		t.Fatalf("AppBaseURL = %q, want the trailing slash dropped", cfg.AppBaseURL)
+	}
+}
+
+func TestLoadValidatesProxies(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/blog")
+	t.Setenv("APP_BASE_URL", "https://blog.example")
+
+	tests := []struct {
+		header, proxies string
+		wantErr         bool
+	}{
+		{"", "", false},
+		{"X-Real-IP", "10.0.0.1, 10.1.0.0/16", false},
+		{"X-Real-IP", "", true},
+		{"X-Real-IP", "proxy.internal", true},
+		{"", "10.0.0.0/33", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("PROXY_HEADER", tt.header)
+		t.Setenv("TRUSTED_PROXIES", tt.proxies)
+		cfg, err := Load()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PROXY_HEADER=%q TRUSTED_PROXIES=%q: err = %v, want error %v", tt.header, tt.proxies, err, tt.wantErr)
+		}
+		if err == nil && tt.proxies != "" && len(cfg.TrustedProxies) != 2 {
+			t.Errorf("TrustedProxies = %q", cfg.TrustedProxies)
+		}
+	}
+}
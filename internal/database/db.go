@@ -2,6 +2,7 @@ package database
 
 import (
 	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -12,10 +13,153 @@ func Connect(dsn string) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}, &models.LikesandDislikes{}, &models.Bookmark{}, &models.Contact{})
+	// The counters are kept up to date as follows, posts, reactions and
+	// comments change; they only need computing once, when the columns are
+	// first added.
+	backfillCounts := !db.Migrator().HasColumn(&models.User{}, "followers_count")
+	backfillPostCounts := !db.Migrator().HasColumn(&models.Post{}, "likes_count")
+
+	// posts_count used to include drafts, scheduled and archived posts. It is
+	// counted again, once, when the index it is counted with is added.
+	recountPosts := db.Migrator().HasTable(&models.Post{}) && !db.Migrator().HasIndex(&models.Post{}, "idx_posts_user_status")
+
+	// Accounts from before email verification was required are taken as
+	// verified, so they aren't locked out of posting and commenting.
+	verifyExisting := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
+	// Before statuses were enforced every post was shown to everyone, so
+	// existing posts start out published.
+	publishExisting := !db.Migrator().HasColumn(&models.Post{}, "published_at")
+
+	// Posts written before revisions were kept get their current text as
+	// their first revision.
+	backfillRevisions := !db.Migrator().HasTable(&models.PostRevision{})
+
+	// The unique index on slugs can only be created once no author has two
+	// posts with the same slug.
+	if db.Migrator().HasTable(&models.Post{}) && !db.Migrator().HasIndex(&models.Post{}, "idx_posts_user_slug") {
+		if err := uniquePostSlugs(db); err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}, &models.LikesandDislikes{}, &models.Bookmark{}, &models.Contact{}, &models.RefreshToken{}, &models.SigningKey{}, &models.UserToken{}, &models.RecoveryCode{}, &models.PersonalAccessToken{}, &models.AuditLog{}, &models.LoginAttempt{}, &models.UserIdentity{}, &models.OAuthState{}, &models.Session{}, &models.DataExport{}, &models.FollowRequest{}, &models.UserBlock{}, &models.UserMute{}, &models.UsernameHistory{}, &models.SocialLink{}, &models.PostRevision{}, &models.PostSlugHistory{})
 	if err != nil {
 		return nil, err
 	}
 
+	// Statuses are settled first, since only published posts are counted.
+	if publishExisting {
+		if err := publishExistingPosts(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if backfillCounts {
+		if err := countUserStats(db); err != nil {
+			return nil, err
+		}
+	}
+	if backfillCounts || recountPosts {
+		if err := countPosts(db); err != nil {
+			return nil, err
+		}
+	}
+	if backfillPostCounts {
+		if err := countPostStats(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if verifyExisting {
+		if err := verifyExistingUsers(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if backfillRevisions {
+		if err := createFirstRevisions(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setupPostSearch(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
+
+func countUserStats(db *gorm.DB) error {
+	return db.Exec(`UPDATE users SET
+		followers_count = (SELECT COUNT(*) FROM user_followers WHERE following_id = users.id),
+		following_count = (SELECT COUNT(*) FROM user_followers WHERE follower_id = users.id)`).Error
+}
+
+func countPosts(db *gorm.DB) error {
+	return db.Exec(`UPDATE users SET
+		posts_count = (SELECT COUNT(*) FROM posts WHERE user_id = users.id AND status = ? AND deleted_at IS NULL)`,
+		models.PostPublished).Error
+}
+
+func countPostStats(db *gorm.DB) error {
+	return db.Exec(`UPDATE posts SET
+		likes_count = (SELECT COUNT(*) FROM likesand_dislikes WHERE post_id = posts.id AND reaction_type = 'like'),
+		dislikes_count = (SELECT COUNT(*) FROM likesand_dislikes WHERE post_id = posts.id AND reaction_type = 'dislike'),
+		comments_count = (SELECT COUNT(*) FROM comments WHERE post_id = posts.id AND deleted_at IS NULL)`).Error
+}
+
+func verifyExistingUsers(db *gorm.DB) error {
+	return db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error
+}
+
+func publishExistingPosts(db *gorm.DB) error {
+	return db.Exec("UPDATE posts SET status = ?, published_at = created_at", models.PostPublished).Error
+}
+
+func createFirstRevisions(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO post_revisions (post_id, number, title, description, content, tags, editor_id, created_at)
+		SELECT id, 1, title, description, content, tags, user_id, created_at FROM posts`).Error
+}
+
+// uniquePostSlugs gives posts without a slug, such as those whose title had
+// no ASCII letters, one made from their title, and numbers the slugs an
+// author used more than once. Slugs that were already unique are kept, and
+// of a repeated slug the oldest post keeps it, as that's the one links to it
+// found.
+func uniquePostSlugs(db *gorm.DB) error {
+	var posts []models.Post
+	if err := db.Select("id", "user_id", "title", "slug").Order("id").Find(&posts).Error; err != nil {
+		return err
+	}
+
+	taken := map[uint]map[string]bool{}
+	var renamed []models.Post
+	for _, post := range posts {
+		if taken[post.UserID] == nil {
+			taken[post.UserID] = map[string]bool{}
+		}
+		if post.Slug == "" || taken[post.UserID][post.Slug] {
+			renamed = append(renamed, post)
+			continue
+		}
+		taken[post.UserID][post.Slug] = true
+	}
+
+	for _, post := range renamed {
+		slug := post.Slug
+		if slug == "" {
+			slug = utils.CreateSlug(post.Title)
+		}
+		candidate := slug
+		for n := 2; taken[post.UserID][candidate]; n++ {
+			candidate = utils.NumberedSlug(slug, n)
+		}
+		taken[post.UserID][candidate] = true
+
+		if err := db.Model(&post).Update("slug", candidate).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
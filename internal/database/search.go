@@ -0,0 +1,48 @@
+package database
+
+import "gorm.io/gorm"
+
+// SearchConfig is the text search configuration posts are indexed with.
+// Queries have to use the same one.
+const SearchConfig = "english"
+
+// setupPostSearch maintains posts.search_vector, a weighted tsvector over the
+// title and tags (A), description (B) and content (C), with a trigger and a
+// GIN index. The column isn't part of the Post model, so it is created here
+// rather than by AutoMigrate. A generated column can't be used because
+// array_to_string isn't immutable.
+func setupPostSearch(db *gorm.DB) error {
+	backfill := !db.Migrator().HasColumn("posts", "search_vector")
+
+	statements := []string{
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector)`,
+		`CREATE OR REPLACE FUNCTION posts_search_vector_update() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector :=
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(NEW.title, '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(array_to_string(NEW.tags, ' '), '')), 'A') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(NEW.description, '')), 'B') ||
+				setweight(to_tsvector('` + SearchConfig + `', coalesce(NEW.content, '')), 'C');
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS posts_search_vector_trigger ON posts`,
+		`CREATE TRIGGER posts_search_vector_trigger
+			BEFORE INSERT OR UPDATE OF title, description, content, tags ON posts
+			FOR EACH ROW EXECUTE FUNCTION posts_search_vector_update()`,
+	}
+	if backfill {
+		// Touching the title fires the trigger for existing posts.
+		statements = append(statements, `UPDATE posts SET title = title`)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,314 @@
+// Package diff compares texts line by line or word by word using Myers'
+// algorithm, and formats line comparisons as unified diffs.
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a run of text that both versions share, or that only the new or
+// only the old version has.
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words are runs of letters and digits; the whitespace and punctuation
+// between them are tokens of their own, so no text is lost.
+var wordToken = regexp.MustCompile(`[\pL\pN_]+|\s+|.`)
+
+// Lines compares a and b line by line. Each edit is one line, without its
+// line break. Empty text has no lines.
+func Lines(a, b string) []Edit {
+	return compare(splitLines(a), splitLines(b))
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// Words compares a and b word by word, joining neighbouring edits of the
+// same kind. Concatenating the equal and delete edits gives a; the equal and
+// insert edits give b.
+func Words(a, b string) []Edit {
+	tokens := compare(wordToken.FindAllString(a, -1), wordToken.FindAllString(b, -1))
+
+	var edits []Edit
+	var text strings.Builder
+	for i, token := range tokens {
+		text.WriteString(token.Text)
+		if i+1 < len(tokens) && tokens[i+1].Op == token.Op {
+			continue
+		}
+		edits = append(edits, Edit{Op: token.Op, Text: text.String()})
+		text.Reset()
+	}
+	return edits
+}
+
+// Changed reports whether edits has anything other than equal text.
+func Changed(edits []Edit) bool {
+	for _, edit := range edits {
+		if edit.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified formats line edits from Lines as a unified diff with context lines
+// around each change. It returns an empty string when nothing changed.
+func Unified(fromName, toName string, edits []Edit, context int) string {
+	if !Changed(edits) {
+		return ""
+	}
+
+	// fromLine[i] and toLine[i] count the lines of each version before edit i.
+	fromLine := make([]int, len(edits)+1)
+	toLine := make([]int, len(edits)+1)
+	for i, edit := range edits {
+		fromLine[i+1], toLine[i+1] = fromLine[i], toLine[i]
+		if edit.Op != Insert {
+			fromLine[i+1]++
+		}
+		if edit.Op != Delete {
+			toLine[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; ; {
+		for i < len(edits) && edits[i].Op == Equal {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Changes closer than twice the context share a hunk.
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next == len(edits) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+
+		start := max(i-context, 0)
+		stop := min(end+context, len(edits))
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(fromLine[start], fromLine[stop]-fromLine[start]),
+			hunkRange(toLine[start], toLine[stop]-toLine[start]))
+		for _, edit := range edits[start:stop] {
+			switch edit.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Delete:
+				sb.WriteString("-")
+			case Insert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(edit.Text)
+			sb.WriteString("\n")
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// hunkRange formats the lines a hunk covers. An empty range names the line
+// before it, as in GNU diff.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+const (
+	// maxTokens is the most tokens, old and new together, that are compared
+	// one by one. Longer texts are shown as replaced outright.
+	maxTokens = 100000
+
+	// maxCost bounds how many edits the search for a middle snake tries
+	// before giving up on a stretch of text and showing it as replaced, so
+	// that the time a comparison takes stays proportional to its length.
+	maxCost = 1000
+)
+
+// compare returns one edit per token turning a into b.
+func compare(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	if len(a)+len(b) > maxTokens {
+		return replace(edits, a, b)
+	}
+	size := 2*((len(a)+len(b)+1)/2+1) + 1
+	d := &differ{forward: make([]int, size), backward: make([]int, size)}
+	return d.diff(edits, a, b)
+}
+
+// differ holds the furthest points reached on each diagonal while looking
+// for a middle snake. Each search is done before the halves either side of
+// its snake are searched, so they all share the same space.
+type differ struct {
+	forward, backward []int
+}
+
+// diff appends the edits turning a into b to edits. The common prefix and
+// suffix are matched up front, which keeps the search small for typical
+// edits to long texts.
+func (df *differ) diff(edits []Edit, a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, token := range a[:prefix] {
+		edits = append(edits, Edit{Op: Equal, Text: token})
+	}
+	edits = df.bisect(edits, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, token := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Op: Equal, Text: token})
+	}
+	return edits
+}
+
+// bisect finds the middle snake of a shortest edit script between a and b,
+// searching forward from the start and backward from the end at once, and
+// diffs the two halves either side of it. This is the linear space variant
+// of Myers' algorithm: only the furthest point reached on each diagonal is
+// kept, for the current number of edits.
+func (df *differ) bisect(edits []Edit, a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(edits, a, b)
+	}
+
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	forward := df.forward[:2*offset+1]
+	backward := df.backward[:2*offset+1]
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	// When the lengths differ by an odd number the paths meet while going
+	// forward, otherwise while going backward.
+	delta := n - m
+	odd := delta%2 != 0
+
+	// Diagonals that ran off the edge are not searched again.
+	kStart, kEnd, rStart, rEnd := 0, 0, 0, 0
+	for d := 0; d <= maxD && d <= maxCost; d++ {
+		for k := -d + kStart; k <= d-kEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				kEnd += 2
+			case y > m:
+				kStart += 2
+			case odd:
+				r := offset + delta - k
+				if r >= 0 && r < len(backward) && backward[r] != -1 && x >= n-backward[r] {
+					return df.split(edits, a, b, x, y)
+				}
+			}
+		}
+
+		for k := -d + rStart; k <= d-rEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				rEnd += 2
+			case y > m:
+				rStart += 2
+			case !odd:
+				f := offset + delta - k
+				if f >= 0 && f < len(forward) && forward[f] != -1 {
+					fx := forward[f]
+					fy := fx - (f - offset)
+					if fx >= n-x {
+						return df.split(edits, a, b, fx, fy)
+					}
+				}
+			}
+		}
+	}
+
+	// The texts differ too much to be worth comparing token by token.
+	return replace(edits, a, b)
+}
+
+// split diffs a and b on either side of the point x, y that a shortest edit
+// script passes through.
+func (df *differ) split(edits []Edit, a, b []string, x, y int) []Edit {
+	edits = df.diff(edits, a[:x], b[:y])
+	return df.diff(edits, a[x:], b[y:])
+}
+
+// replace appends edits deleting all of a and inserting all of b.
+func replace(edits []Edit, a, b []string) []Edit {
+	for _, token := range a {
+		edits = append(edits, Edit{Op: Delete, Text: token})
+	}
+	for _, token := range b {
+		edits = append(edits, Edit{Op: Insert, Text: token})
+	}
+	return edits
+}
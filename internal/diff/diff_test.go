@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func eq(text string) Edit  { return Edit{Op: Equal, Text: text} }
+func ins(text string) Edit { return Edit{Op: Insert, Text: text} }
+func del(text string) Edit { return Edit{Op: Delete, Text: text} }
+
+// versions rebuilds the old and new texts from edits.
+func versions(edits []Edit) (a, b []string) {
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			a = append(a, edit.Text)
+		}
+		if edit.Op != Delete {
+			b = append(b, edit.Text)
+		}
+	}
+	return a, b
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Edit
+	}{
+		{"", "", []Edit{}},
+		{"", "one", []Edit{ins("one")}},
+		{"one\ntwo", "", []Edit{del("one"), del("two")}},
+		{"one\ntwo\nthree", "one\ntwo\nthree", []Edit{eq("one"), eq("two"), eq("three")}},
+		{"one\ntwo\nthree", "one\n2\nthree", []Edit{eq("one"), del("two"), ins("2"), eq("three")}},
+	}
+	for _, tt := range tests {
+		got := Lines(tt.a, tt.b)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// The example from Myers' paper has several shortest edit scripts, all
+	// with five edits.
+	a, b := "a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc"
+	edits := Lines(a, b)
+	gotA, gotB := versions(edits)
+	if strings.Join(gotA, "\n") != a || strings.Join(gotB, "\n") != b {
+		t.Fatalf("Lines(%q, %q) = %v doesn't rebuild both versions", a, b, edits)
+	}
+	changes := 0
+	for _, edit := range edits {
+		if edit.Op != Equal {
+			changes++
+		}
+	}
+	if changes != 5 {
+		t.Fatalf("Lines(%q, %q) = %v has %d changes, want 5", a, b, edits, changes)
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Edit
+	}{
+		{"the quick fox", "the quick fox", []Edit{eq("the quick fox")}},
+		{"the quick fox", "the slow fox", []Edit{eq("the "), del("quick"), ins("slow"), eq(" fox")}},
+		{"Hello, world!", "Hello there, world!", []Edit{eq("Hello"), ins(" there"), eq(", world!")}},
+		{"", "new text", []Edit{ins("new text")}},
+		{"naïve café", "naïve cafés", []Edit{eq("naïve "), del("café"), ins("cafés")}},
+	}
+	for _, tt := range tests {
+		got := Words(tt.a, tt.b)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Words(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+
+		var a, b strings.Builder
+		for _, edit := range got {
+			if edit.Op != Insert {
+				a.WriteString(edit.Text)
+			}
+			if edit.Op != Delete {
+				b.WriteString(edit.Text)
+			}
+		}
+		if a.String() != tt.a || b.String() != tt.b {
+			t.Errorf("Words(%q, %q) lost text: %q, %q", tt.a, tt.b, a.String(), b.String())
+		}
+	}
+}
+
+func numbered(n int, change map[int]string) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+		if text, ok := change[i+1]; ok {
+			lines[i] = text
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"unchanged", "one\ntwo", "one\ntwo", ""},
+		{"from empty", "", "one\ntwo", "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+one\n+two\n"},
+		{"to empty", "one", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-one\n"},
+		{
+			"changes within twice the context share a hunk",
+			numbered(12, nil),
+			numbered(12, map[int]string{3: "three", 8: "eight"}),
+			"--- a\n+++ b\n@@ -1,10 +1,10 @@\n line 1\n line 2\n-line 3\n+three\n line 4\n line 5\n line 6\n line 7\n-line 8\n+eight\n line 9\n line 10\n",
+		},
+		{
+			"changes further apart get their own hunks",
+			numbered(12, nil),
+			numbered(12, map[int]string{2: "two", 11: "eleven"}),
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n line 1\n-line 2\n+two\n line 3\n line 4\n@@ -9,4 +9,4 @@\n line 9\n line 10\n-line 11\n+eleven\n line 12\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := Unified("a", "b", Lines(tt.a, tt.b), 2); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareGivesUpOnCostlyStretches(t *testing.T) {
+	// Every other token is shared, so a shortest edit script keeps them, but
+	// finding it takes more than maxCost edits.
+	var a, b []string
+	for i := 0; i < 2*maxCost; i++ {
+		a = append(a, fmt.Sprintf("a%d", i), fmt.Sprintf("shared%d", i))
+		b = append(b, fmt.Sprintf("b%d", i), fmt.Sprintf("shared%d", i))
+	}
+	a = append(a, "a-end")
+	b = append(b, "b-end")
+
+	edits := compare(a, b)
+	gotA, gotB := versions(edits)
+	if !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+		t.Fatal("edits don't rebuild both versions")
+	}
+	for _, edit := range edits {
+		if edit.Op == Equal {
+			t.Fatalf("expected the costly stretch to be replaced outright, found equal %q", edit.Text)
+		}
+	}
+
+	// Below the limit the shared tokens are found.
+	edits = compare(a[:20], b[:20])
+	if !reflect.DeepEqual(edits[:3], []Edit{del("a0"), ins("b0"), eq("shared0")}) {
+		t.Fatalf("compare() = %v", edits)
+	}
+}
+
+func TestCompareReplacesHugeTexts(t *testing.T) {
+	a := make([]string, maxTokens)
+	b := make([]string, 1)
+	edits := compare(a, b)
+	if len(edits) != maxTokens+1 || edits[0].Op != Delete || edits[maxTokens].Op != Insert {
+		t.Fatalf("expected %d edits replacing a outright, got %d", maxTokens+1, len(edits))
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// What happens to the posts of a deleted account, set with
+// ACCOUNT_DELETION_POST_POLICY.
+const (
+	deletedPostsKeep     = "keep"
+	deletedPostsDelete   = "delete"
+	deletedPostsTransfer = "transfer"
+)
+
+// deletedUsername replaces the author name on comments left by deleted
+// accounts.
+const deletedUsername = "deleted user"
+
+func deletedPostPolicy() string {
+	if policy := utils.GetSecretOrEnv("ACCOUNT_DELETION_POST_POLICY"); policy != "" {
+		return policy
+	}
+	return deletedPostsKeep
+}
+
+// applyDeletedPostPolicy deletes the posts of a deleted account, hands them to
+// the account named by ACCOUNT_DELETION_TRANSFER_TO, or leaves them in place
+// under the anonymized account.
+func applyDeletedPostPolicy(tx *gorm.DB, userID uint) error {
+	switch policy := deletedPostPolicy(); policy {
+	case deletedPostsKeep:
+		return nil
+	case deletedPostsDelete:
+		return tx.Where("user_id = ?", userID).Delete(&models.Post{}).Error
+	case deletedPostsTransfer:
+		var target models.User
+		username := utils.GetSecretOrEnv("ACCOUNT_DELETION_TRANSFER_TO")
+		if err := tx.Where("username = ?", username).First(&target).Error; err != nil {
+			return fmt.Errorf("transfer account %q: %w", username, err)
+		}
+		if target.ID == userID {
+			return errors.New("cannot transfer posts to the account being deleted")
+		}
+		return transferPosts(tx, userID, target.ID)
+	default:
+		return fmt.Errorf("unknown ACCOUNT_DELETION_POST_POLICY %q", policy)
+	}
+}
+
+// transferPosts hands the posts of one author to another, one at a time so
+// that each can be given a new slug if the new author already uses its own.
+func transferPosts(tx *gorm.DB, fromID, toID uint) error {
+	if err := lockAuthor(tx, toID); err != nil {
+		return err
+	}
+
+	var posts []models.Post
+	if err := tx.Select("id", "user_id", "slug", "status").Where("user_id = ?", fromID).Find(&posts).Error; err != nil {
+		return err
+	}
+	published := 0
+	for i := range posts {
+		post := &posts[i]
+		if post.Status == models.PostPublished {
+			published++
+		}
+		taken, err := postSlugTaken(tx, toID, post.ID, post.Slug)
+		if err != nil {
+			return err
+		}
+		if taken {
+			slug, err := uniquePostSlug(tx, toID, post.ID, post.Slug)
+			if err != nil {
+				return err
+			}
+			if err := changePostSlug(tx, post, slug); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(post).Update("user_id", toID).Error; err != nil {
+			return err
+		}
+	}
+	return adjustPostsCount(tx, toID, published)
+}
+
+// DeleteAccount soft-deletes the logged in user after confirming their
+// password and, when enabled, their second factor. Personal data is removed
+// or anonymized; what happens to their posts is configurable.
+func (h *UserHandler) DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	if hasUsablePassword(user) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid password",
+			})
+		}
+	}
+	if user.TOTPEnabledAt != nil {
+		ok, err := checkSecondFactor(h.DB, &user, data.Code, data.RecoveryCode)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to verify code",
+				"error":   err.Error(),
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid code",
+			})
+		}
+	}
+
+	anonymousPassword, err := utils.GenerateRandomToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete account",
+			"error":   err.Error(),
+		})
+	}
+
+	var exports []models.DataExport
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyDeletedPostPolicy(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Comment{}).Where("user_id = ?", user.ID).
+			Update("username", deletedUsername).Error; err != nil {
+			return err
+		}
+
+		if err := removeAllReactions(tx, user.ID); err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.Bookmark{},
+			&models.UserIdentity{},
+			&models.RecoveryCode{},
+			&models.UserToken{},
+			&models.SocialLink{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := removeAllFollows(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR following_id = ?", user.ID, user.ID).Delete(&models.FollowRequest{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", user.ID, user.ID).Delete(&models.UserBlock{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("muter_id = ? OR muted_id = ?", user.ID, user.ID).Delete(&models.UserMute{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := revokeAllSessions(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UsernameHistory{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Find(&exports).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.DataExport{}).Error; err != nil {
+			return err
+		}
+
+		// Free the username and email for reuse and drop everything that
+		// identifies the person, keeping the row for the posts that stay.
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"username":          fmt.Sprintf("deleted_user_%d", user.ID),
+			"email":             fmt.Sprintf("deleted-%d@invalid", user.ID),
+			"password":          unusablePasswordPrefix + anonymousPassword,
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"firebase_uid":      nil,
+			"bio":               "",
+			"avatar_url":        "",
+			"display_name":      "",
+			"location":          "",
+			"website":           "",
+			"pronouns":          "",
+			"cover_image_url":   "",
+			"show_email":        false,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete account",
+			"error":   err.Error(),
+		})
+	}
+
+	for _, export := range exports {
+		removeExportFile(export)
+	}
+	recordAudit(h.DB, &user.ID, models.AuditAccountDeleted, c.IP(), deletedPostPolicy())
+
+	clearRefreshTokenCookie(c)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account deleted successfully",
+	})
+}
+
+func removeExportFile(export models.DataExport) {
+	if export.FilePath == "" {
+		return
+	}
+	if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove export %d: %v", export.ID, err)
+	}
+}
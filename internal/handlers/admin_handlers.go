@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func (h *UserHandler) UpdateUserRole(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if !policy.ValidRole(data.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Role must be one of admin, editor, author or reader",
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if user.ID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "You cannot change your own role",
+		})
+	}
+
+	if err := h.DB.Model(&user).Update("role", data.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update role",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Role updated successfully",
+		"user_id": user.ID,
+		"role":    data.Role,
+	})
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"gorm.io/gorm"
+)
+
+// recordAudit stores a security event. Failing to write the entry is logged
+// but never fails the request that triggered it.
+func recordAudit(db *gorm.DB, userID *uint, event, ip, details string) {
+	entry := models.AuditLog{
+		UserID:  userID,
+		Event:   event,
+		IP:      ip,
+		Details: details,
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("failed to write audit entry %s: %v", event, err)
+	}
+}
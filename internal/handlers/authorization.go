@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// currentRole returns the caller's role for a policy check on content owned
+// by ownerID. Acting on someone else's content is sensitive, so the role is
+// then read from the database rather than trusted from the access token.
+func currentRole(db *gorm.DB, c *fiber.Ctx, ownerID uint) (string, error) {
+	userID, _ := c.Locals("user_id").(uint)
+	role, _ := c.Locals("role").(string)
+	if ownerID == userID {
+		return role, nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// targetUser loads the user named by the :id parameter, refusing the caller
+// themselves.
+func (h *UserHandler) targetUser(c *fiber.Ctx, action string) (*models.User, error) {
+	userID := c.Locals("user_id").(uint)
+
+	targetID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	if uint(targetID) == userID {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "You cannot " + action + " yourself",
+		})
+	}
+
+	var target models.User
+	if err := h.DB.First(&target, targetID).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+	return &target, nil
+}
+
+// BlockUser blocks a user and removes any follows and follow requests
+// between the two accounts.
+func (h *UserHandler) BlockUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	target, err := h.targetUser(c, "block")
+	if target == nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		block := models.UserBlock{BlockerID: userID, BlockedID: target.ID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+
+		if err := removeFollow(tx, userID, target.ID); err != nil {
+			return err
+		}
+		if err := removeFollow(tx, target.ID, userID); err != nil {
+			return err
+		}
+
+		return tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			userID, target.ID, target.ID, userID).
+			Delete(&models.FollowRequest{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to block user",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User blocked",
+	})
+}
+
+func (h *UserHandler) UnblockUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	target, err := h.targetUser(c, "unblock")
+	if target == nil {
+		return err
+	}
+
+	if err := h.DB.Where("blocker_id = ? AND blocked_id = ?", userID, target.ID).
+		Delete(&models.UserBlock{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to unblock user",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unblocked",
+	})
+}
+
+func (h *UserHandler) GetBlockedUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var blocks []models.UserBlock
+	if err := h.DB.Preload("Blocked").Where("blocker_id = ?", userID).Order("created_at DESC").Find(&blocks).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch blocked users",
+			"error":   err.Error(),
+		})
+	}
+
+	blocked := make([]UserView, 0, len(blocks))
+	for _, block := range blocks {
+		blocked = append(blocked, publicView(block.Blocked))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"blocked": blocked,
+	})
+}
+
+// MuteUser hides a user's posts and comments from the caller without them
+// knowing. Follows are left alone.
+func (h *UserHandler) MuteUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	target, err := h.targetUser(c, "mute")
+	if target == nil {
+		return err
+	}
+
+	mute := models.UserMute{MuterID: userID, MutedID: target.ID}
+	if err := h.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to mute user",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User muted",
+	})
+}
+
+func (h *UserHandler) UnmuteUser(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	target, err := h.targetUser(c, "unmute")
+	if target == nil {
+		return err
+	}
+
+	if err := h.DB.Where("muter_id = ? AND muted_id = ?", userID, target.ID).
+		Delete(&models.UserMute{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to unmute user",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unmuted",
+	})
+}
+
+func (h *UserHandler) GetMutedUsers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var mutes []models.UserMute
+	if err := h.DB.Preload("Muted").Where("muter_id = ?", userID).Order("created_at DESC").Find(&mutes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch muted users",
+			"error":   err.Error(),
+		})
+	}
+
+	muted := make([]UserView, 0, len(mutes))
+	for _, mute := range mutes {
+		muted = append(muted, publicView(mute.Muted))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"muted": muted,
+	})
+}
@@ -48,6 +48,9 @@ func (h *BookmarkHandler) BookmarkPost(c *fiber.Ctx) error {
 			"message": "Invalid post ID",
 		})
 	}
+	if hidden, err := postNotVisible(h.DB, c, postIDUint); hidden {
+		return err
+	}
 	bookmark.PostID = uint(postIDUint)
 	bookmark.UserID = uint(userID)
 
@@ -66,12 +69,8 @@ func (h *BookmarkHandler) BookmarkPost(c *fiber.Ctx) error {
 func (h *BookmarkHandler) GetBookmarkCount(c *fiber.Ctx) error {
 	postID := c.Params("post_id")
 
-	var post models.Post
-	findPost := h.DB.First(&post, postID)
-	if findPost.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Post not available",
-		})
+	if hidden, err := postNotVisible(h.DB, c, postID); hidden {
+		return err
 	}
 
 	var count int64
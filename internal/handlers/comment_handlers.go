@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -49,6 +50,10 @@ func (h *CommentHandler) AddComment(c *fiber.Ctx) error {
 		comment.ParentID = &parentIDUint32
 	}
 
+	if hidden, err := postNotVisible(h.DB, c, num); hidden {
+		return err
+	}
+
 	userID := c.Locals("user_id").(uint)
 	userName := c.Locals("username").(string)
 	comment.UserID = userID
@@ -56,11 +61,16 @@ func (h *CommentHandler) AddComment(c *fiber.Ctx) error {
 	comment.Username = userName
 	comment.CreatedAt = time.Now()
 
-	result := h.DB.Create(&comment)
-	if result.Error != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		return adjustCommentsCount(tx, comment.PostID, 1)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to add comment",
-			"error":   result.Error.Error(),
+			"error":   err.Error(),
 		})
 	}
 
@@ -77,7 +87,14 @@ func (h *CommentHandler) UpdateComment(c *fiber.Ctx) error {
 		})
 	}
 	userID := c.Locals("user_id").(uint)
-	if comment.UserID != userID {
+	role, err := currentRole(h.DB, c, comment.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
+	if !policy.CanEditComment(role, userID, comment) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "You are not authorized to update this comment",
 		})
@@ -111,16 +128,29 @@ func (h *CommentHandler) DeleteComment(c *fiber.Ctx) error {
 		})
 	}
 	userID := c.Locals("user_id").(uint)
-	if comment.UserID != userID {
+	role, err := currentRole(h.DB, c, comment.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
+	if !policy.CanDeleteComment(role, userID, comment) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "You are not authorized to delete this comment",
 		})
 	}
-	deleteResult := h.DB.Delete(&comment)
-	if deleteResult.Error != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&comment)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return adjustCommentsCount(tx, comment.PostID, -1)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Unable to delete comment",
-			"error":   deleteResult.Error.Error(),
+			"error":   err.Error(),
 		})
 	}
 
@@ -131,18 +161,27 @@ func (h *CommentHandler) DeleteComment(c *fiber.Ctx) error {
 func (h *CommentHandler) GetCommentsandCount(c *fiber.Ctx) error {
 	postID := c.Params("id")
 
+	if hidden, err := postNotVisible(h.DB, c, postID); hidden {
+		return err
+	}
+
 	var comments []models.Comment
 	var count int64
 
-	if err := h.DB.Where("post_id = ? AND parent_id IS NULL", postID).
-		Preload("Replies.Replies.Replies.Replies").
-		Find(&comments).Error; err != nil {
+	// Comments by blocked or muted users are left out at every depth.
+	hide := withoutHiddenUsers("user_id", c.Locals("user_id").(uint))
+	query := h.DB.Scopes(hide).Where("post_id = ? AND parent_id IS NULL", postID)
+	for _, replies := range []string{"Replies", "Replies.Replies", "Replies.Replies.Replies", "Replies.Replies.Replies.Replies"} {
+		query = query.Preload(replies, hide)
+	}
+
+	if err := query.Find(&comments).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch Comments",
 		})
 	}
 
-	if err := h.DB.Model(&models.Comment{}).Where("post_id = ? AND parent_id is NULL", postID).Count(&count).Error; err != nil {
+	if err := h.DB.Model(&models.Comment{}).Scopes(hide).Where("post_id = ? AND parent_id is NULL", postID).Count(&count).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to count Comments",
 		})
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/mailer"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+func (h *UserHandler) sendVerificationEmail(c *fiber.Ctx, user models.User) error {
+	token, err := createUserToken(h.DB, user.ID, models.EmailVerificationToken, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := h.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, link, emailVerificationTTL),
+	})
+}
+
+func (h *UserHandler) VerifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Verification token is required",
+		})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := consumeUserToken(tx, token, models.EmailVerificationToken)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", stored.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidUserToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid or expired verification token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to verify email",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerificationEmail always answers the same way so it can't be used to
+// find out which emails are registered.
+func (h *UserHandler) ResendVerificationEmail(c *fiber.Ctx) error {
+	var data struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if data.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Email is required",
+		})
+	}
+
+	var user models.User
+	err := h.DB.Where("email = ? AND email_verified_at IS NULL", data.Email).First(&user).Error
+	if err == nil {
+		if err := h.sendVerificationEmail(c, user); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If the account exists and is not yet verified, a verification email has been sent",
+	})
+}
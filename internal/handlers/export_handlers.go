@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const exportTTL = 7 * 24 * time.Hour
+
+// exportBuildTimeout is how long an export may stay pending. One that takes
+// longer was lost, typically to a restart while it was being built.
+const exportBuildTimeout = 15 * time.Minute
+
+func exportDir() string {
+	if dir := utils.GetSecretOrEnv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "tmp/exports"
+}
+
+// accountExport is everything a user has put into the service.
+type accountExport struct {
+	ExportedAt time.Time                 `json:"exported_at"`
+	Profile    UserView                  `json:"profile"`
+	Posts      []models.Post             `json:"posts"`
+	Comments   []models.Comment          `json:"comments"`
+	Reactions  []models.LikesandDislikes `json:"reactions"`
+	Bookmarks  []models.Bookmark         `json:"bookmarks"`
+	Followers  []string                  `json:"followers"`
+	Following  []string                  `json:"following"`
+}
+
+func collectAccountExport(db *gorm.DB, userID uint) (*accountExport, error) {
+	var user models.User
+	if err := db.Preload("SocialLinks", orderByID).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	data := &accountExport{
+		ExportedAt: time.Now(),
+		Profile:    selfView(user),
+		Followers:  []string{},
+		Following:  []string{},
+	}
+
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&data.Posts).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&data.Comments).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&data.Reactions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&data.Bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("users").
+		Joins("JOIN user_followers ON user_followers.follower_id = users.id").
+		Where("user_followers.following_id = ? AND users.deleted_at IS NULL", userID).
+		Order("users.username").
+		Pluck("users.username", &data.Followers).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Table("users").
+		Joins("JOIN user_followers ON user_followers.following_id = users.id").
+		Where("user_followers.follower_id = ? AND users.deleted_at IS NULL", userID).
+		Order("users.username").
+		Pluck("users.username", &data.Following).Error; err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// writeAccountExport writes data as one JSON document, or as a ZIP archive
+// with one JSON file per section.
+func writeAccountExport(path, format string, data *accountExport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == models.ExportFormatJSON {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	archive := zip.NewWriter(f)
+	sections := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", data.Profile},
+		{"posts.json", data.Posts},
+		{"comments.json", data.Comments},
+		{"reactions.json", data.Reactions},
+		{"bookmarks.json", data.Bookmarks},
+		{"followers.json", data.Followers},
+		{"following.json", data.Following},
+	}
+	for _, section := range sections {
+		w, err := archive.Create(section.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(section.value); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// buildExport runs in the background and records the outcome on the export,
+// as long as it is still pending.
+func buildExport(db *gorm.DB, export models.DataExport) {
+	updates := map[string]interface{}{"completed_at": time.Now()}
+
+	path := filepath.Join(exportDir(), uuid.NewString()+"."+export.Format)
+	data, err := collectAccountExport(db, export.UserID)
+	if err == nil {
+		err = os.MkdirAll(exportDir(), 0o700)
+	}
+	if err == nil {
+		err = writeAccountExport(path, export.Format, data)
+	}
+
+	if err != nil {
+		log.Printf("data export %d failed: %v", export.ID, err)
+		os.Remove(path)
+		updates["status"] = models.ExportFailed
+		updates["error"] = "Failed to build export"
+	} else {
+		updates["status"] = models.ExportReady
+		updates["file_path"] = path
+	}
+
+	// The export may have been deleted with the account, or given up on by
+	// failStalledExports, while it was being built. Then nothing points to
+	// the archive any more and it is removed.
+	result := db.Model(&models.DataExport{}).
+		Where("id = ? AND status = ?", export.ID, models.ExportPending).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("failed to update data export %d: %v", export.ID, result.Error)
+	}
+	if result.Error != nil || result.RowsAffected == 0 {
+		os.Remove(path)
+	}
+}
+
+func purgeExpiredExports(db *gorm.DB) error {
+	var expired []models.DataExport
+	if err := db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, export := range expired {
+		removeExportFile(export)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return db.Delete(&expired).Error
+}
+
+// failStalledExports marks the user's exports that have been pending for
+// longer than exportBuildTimeout as failed, so they don't hold up new ones.
+func failStalledExports(db *gorm.DB, userID uint) error {
+	now := time.Now()
+	return db.Model(&models.DataExport{}).
+		Where("user_id = ? AND status = ? AND created_at < ?", userID, models.ExportPending, now.Add(-exportBuildTimeout)).
+		Updates(map[string]interface{}{
+			"status":       models.ExportFailed,
+			"error":        "Export was interrupted, please request a new one",
+			"completed_at": now,
+		}).Error
+}
+
+// RequestExport starts building an archive of the user's data. Poll
+// GetExport until it is ready, then download it.
+func (h *UserHandler) RequestExport(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Format string `json:"format"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Unable to parse request body",
+				"error":   err.Error(),
+			})
+		}
+	}
+	if data.Format == "" {
+		data.Format = models.ExportFormatZIP
+	}
+	if data.Format != models.ExportFormatJSON && data.Format != models.ExportFormatZIP {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "format must be json or zip",
+		})
+	}
+
+	if err := purgeExpiredExports(h.DB); err != nil {
+		log.Printf("failed to purge expired data exports: %v", err)
+	}
+
+	if err := failStalledExports(h.DB, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	var pending models.DataExport
+	err := h.DB.Where("user_id = ? AND status = ?", userID, models.ExportPending).First(&pending).Error
+	if err == nil {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "An export is already being prepared",
+			"export":  pending,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	export := models.DataExport{
+		UserID:    userID,
+		Format:    data.Format,
+		Status:    models.ExportPending,
+		ExpiresAt: time.Now().Add(exportTTL),
+	}
+	if err := h.DB.Create(&export).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to start export",
+			"error":   err.Error(),
+		})
+	}
+
+	go buildExport(h.DB, export)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Export started",
+		"export":  export,
+	})
+}
+
+func (h *UserHandler) findExport(c *fiber.Ctx) (*models.DataExport, error) {
+	userID := c.Locals("user_id").(uint)
+
+	err := failStalledExports(h.DB, userID)
+	var export models.DataExport
+	if err == nil {
+		err = h.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&export).Error
+	}
+	if err == nil && time.Now().After(export.ExpiresAt) {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Export not found",
+			})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+	return &export, nil
+}
+
+func (h *UserHandler) GetExport(c *fiber.Ctx) error {
+	export, err := h.findExport(c)
+	if export == nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(export)
+}
+
+func (h *UserHandler) DownloadExport(c *fiber.Ctx) error {
+	export, err := h.findExport(c)
+	if export == nil {
+		return err
+	}
+
+	if export.Status != models.ExportReady {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Export is not ready",
+			"status":  export.Status,
+		})
+	}
+
+	name := "account-export-" + export.CreatedAt.Format("2006-01-02") + "." + export.Format
+	return c.Download(export.FilePath, name)
+}
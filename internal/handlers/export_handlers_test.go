@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStalledExportIsMarkedFailed(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.DataExport{})
+	h := newTestUserHandler(t, db)
+	app := newTestApp()
+	app.Get("/users/me/exports/:id", h.GetExport)
+
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+	stalled := models.DataExport{
+		UserID:    alice.ID,
+		Format:    models.ExportFormatZIP,
+		Status:    models.ExportPending,
+		ExpiresAt: time.Now().Add(exportTTL),
+		CreatedAt: time.Now().Add(-time.Hour),
+	}
+	building := stalled
+	building.CreatedAt = time.Now()
+	db.Create(&stalled)
+	db.Create(&building)
+
+	tests := []struct {
+		export models.DataExport
+		want   string
+	}{
+		{stalled, models.ExportFailed},
+		{building, models.ExportPending},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users/me/exports/"+itoa(tt.export.ID), nil)
+		resp, body := send(t, app, asUser(req, alice.ID))
+		expectStatus(t, resp, body, fiber.StatusOK)
+		if body["status"] != tt.want {
+			t.Errorf("export created at %s: status = %v, want %s", tt.export.CreatedAt, body["status"], tt.want)
+		}
+	}
+}
+
+func TestBuildExportOnlyFinishesPendingExports(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.SocialLink{}, &models.Post{}, &models.Comment{},
+		&models.LikesandDislikes{}, &models.Bookmark{}, &models.DataExport{})
+	dir := t.TempDir()
+	t.Setenv("EXPORT_DIR", dir)
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+
+	newExport := func() models.DataExport {
+		export := models.DataExport{
+			UserID:    alice.ID,
+			Format:    models.ExportFormatZIP,
+			Status:    models.ExportPending,
+			ExpiresAt: time.Now().Add(exportTTL),
+		}
+		db.Create(&export)
+		return export
+	}
+
+	// Given up on while it was being built.
+	stalled := newExport()
+	db.Model(&stalled).Update("status", models.ExportFailed)
+	buildExport(db, stalled)
+	db.First(&stalled, stalled.ID)
+	if stalled.Status != models.ExportFailed || stalled.FilePath != "" {
+		t.Fatalf("a failed export was finished: %+v", stalled)
+	}
+
+	// Deleted with the account while it was being built.
+	deleted := newExport()
+	db.Delete(&deleted)
+	buildExport(db, deleted)
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("%d archives left behind", len(files))
+	}
+
+	pending := newExport()
+	buildExport(db, pending)
+	db.First(&pending, pending.ID)
+	if pending.Status != models.ExportReady {
+		t.Fatalf("status = %s, want ready", pending.Status)
+	}
+	if _, err := os.Stat(pending.FilePath); err != nil {
+		t.Fatalf("archive missing: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com-Personal/go-fiber/internal/models"
+	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// FirebaseAuthHandler lets clients that sign in with Firebase exchange a
+// Firebase ID token for this API's own access and refresh tokens.
+type FirebaseAuthHandler struct {
+	*UserHandler
+	Verifier firebase_utils.TokenVerifier
+}
+
+func NewFirebaseAuthHandler(users *UserHandler, verifier firebase_utils.TokenVerifier) *FirebaseAuthHandler {
+	return &FirebaseAuthHandler{UserHandler: users, Verifier: verifier}
+}
+
+func (h *FirebaseAuthHandler) Login(c *fiber.Ctx) error {
+	var data struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+	if data.IDToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "id_token is required",
+		})
+	}
+
+	identity, err := h.Verifier.VerifyIDToken(c.UserContext(), data.IDToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid or expired Firebase ID token",
+		})
+	}
+
+	var user models.User
+	err = h.DB.Where("firebase_uid = ?", identity.UID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = externalAccount(h.DB, identity.Name, identity.Email, identity.EmailVerified)
+		switch {
+		case errors.Is(err, errExternalEmailMissing):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Firebase account has no email address",
+			})
+		case errors.Is(err, errExternalEmailUnverified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Verify your email with Firebase before signing in",
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to find or create account",
+				"error":   err.Error(),
+			})
+		case user.FirebaseUID != nil:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "This account is already linked to another Firebase user",
+			})
+		}
+
+		err = h.DB.Model(&user).Update("firebase_uid", identity.UID).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if throttled, err := h.loginThrottled(c, user.Email); throttled {
+		return err
+	}
+
+	return h.beginLogin(c, user)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// fakeVerifier accepts the ID tokens it has an identity for.
+type fakeVerifier map[string]*firebase_utils.Identity
+
+func (v fakeVerifier) VerifyIDToken(ctx context.Context, idToken string) (*firebase_utils.Identity, error) {
+	identity, ok := v[idToken]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return identity, nil
+}
+
+func newFirebaseTest(t *testing.T, verifier fakeVerifier) (*gorm.DB, *fiber.App) {
+	t.Helper()
+
+	db := newTestDB(t, &models.User{}, &models.Session{}, &models.RefreshToken{},
+		&models.AuditLog{}, &models.UsernameHistory{}, &models.PersonalAccessToken{},
+		&models.RecoveryCode{}, &models.UserIdentity{})
+	h := NewFirebaseAuthHandler(newTestUserHandler(t, db), verifier)
+	app := newTestApp()
+	app.Post("/login/firebase", h.Login)
+	return db, app
+}
+
+func firebaseLogin(t *testing.T, app *fiber.App, idToken string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/login/firebase", strings.NewReader(`{"id_token":"`+idToken+`"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return send(t, app, req)
+}
+
+func TestFirebaseLoginProvisionsAccount(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{
+		"erin-token": {UID: "erin-uid", Email: "erin@example.com", EmailVerified: true, Name: "Erin"},
+	})
+
+	resp, body := firebaseLogin(t, app, "erin-token")
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	var user models.User
+	if err := db.Where("firebase_uid = ?", "erin-uid").First(&user).Error; err != nil {
+		t.Fatalf("account was not created: %v", err)
+	}
+	if user.Email != "erin@example.com" || user.EmailVerifiedAt == nil || hasUsablePassword(user) {
+		t.Fatalf("unexpected account %+v", user)
+	}
+
+	// Signing in again uses the same account.
+	resp, body = firebaseLogin(t, app, "erin-token")
+	expectStatus(t, resp, body, fiber.StatusOK)
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d accounts, want 1", count)
+	}
+}
+
+func TestFirebaseLoginLinksAccountByEmail(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{
+		"frank-token": {UID: "frank-uid", Email: "Frank@Example.com", EmailVerified: true},
+	})
+	user := createTestUser(t, db, models.User{Username: "frank", Email: "frank@example.com"})
+
+	resp, body := firebaseLogin(t, app, "frank-token")
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	self, _ := body["user"].(map[string]interface{})
+	if self["username"] != "frank" {
+		t.Fatalf("logged in as %v, want frank", self["username"])
+	}
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.FirebaseUID == nil || *user.FirebaseUID != "frank-uid" {
+		t.Fatalf("firebase_uid = %v, want frank-uid", user.FirebaseUID)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("the email Firebase verified was not marked verified")
+	}
+}
+
+func TestFirebaseLoginClaimsUnverifiedAccount(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{
+		"judy-token": {UID: "judy-uid", Email: "judy@example.com", EmailVerified: true},
+	})
+	squatted := createSquattedAccount(t, db, "judy", "judy@example.com")
+	squatterUID := "squatter-uid"
+	db.Model(&squatted).Update("firebase_uid", squatterUID)
+
+	resp, body := firebaseLogin(t, app, "judy-token")
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	expectClaimed(t, db, squatted.ID)
+	var user models.User
+	db.First(&user, squatted.ID)
+	if user.FirebaseUID == nil || *user.FirebaseUID != "judy-uid" {
+		t.Fatalf("firebase_uid = %v, want judy-uid", user.FirebaseUID)
+	}
+}
+
+func TestFirebaseLoginRejectsConflictingUID(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{
+		"grace-token": {UID: "new-uid", Email: "grace@example.com", EmailVerified: true},
+	})
+	oldUID := "old-uid"
+	verifiedAt := time.Now()
+	user := createTestUser(t, db, models.User{Username: "grace", Email: "grace@example.com", FirebaseUID: &oldUID, EmailVerifiedAt: &verifiedAt})
+
+	resp, body := firebaseLogin(t, app, "grace-token")
+	expectStatus(t, resp, body, fiber.StatusConflict)
+
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if *user.FirebaseUID != oldUID {
+		t.Fatalf("firebase_uid changed to %s", *user.FirebaseUID)
+	}
+}
+
+func TestFirebaseLoginRejectsUnverifiedEmail(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{
+		"heidi-token": {UID: "heidi-uid", Email: "heidi@example.com"},
+	})
+	user := createTestUser(t, db, models.User{Username: "heidi", Email: "heidi@example.com"})
+
+	resp, body := firebaseLogin(t, app, "heidi-token")
+	expectStatus(t, resp, body, fiber.StatusForbidden)
+
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.FirebaseUID != nil {
+		t.Fatal("an unverified email was enough to link the account")
+	}
+}
+
+func TestFirebaseLoginRejectsMissingEmail(t *testing.T) {
+	_, app := newFirebaseTest(t, fakeVerifier{
+		"ivan-token": {UID: "ivan-uid", EmailVerified: true},
+	})
+
+	resp, body := firebaseLogin(t, app, "ivan-token")
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+}
+
+func TestFirebaseLoginRejectsInvalidToken(t *testing.T) {
+	db, app := newFirebaseTest(t, fakeVerifier{})
+
+	resp, body := firebaseLogin(t, app, "forged-token")
+	expectStatus(t, resp, body, fiber.StatusUnauthorized)
+
+	resp, body = firebaseLogin(t, app, "")
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d accounts created", count)
+	}
+}
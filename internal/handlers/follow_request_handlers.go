@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// privateAccount responds with 403 when the caller may not see the follower
+// lists of a private account.
+func (h *UserHandler) privateAccount(c *fiber.Ctx, owner models.User) (bool, error) {
+	visible, err := canSeeContent(h.DB, c.Locals("user_id").(uint), owner)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check visibility",
+			"error":   err.Error(),
+		})
+	}
+	if !visible {
+		return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "This account is private",
+		})
+	}
+	return false, nil
+}
+
+func (h *UserHandler) requestFollow(c *fiber.Ctx, follower, following models.User) error {
+	already, err := followsUser(h.DB, follower.ID, following.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+	if already {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Successfully followed user",
+		})
+	}
+
+	request := models.FollowRequest{FollowerID: follower.ID, FollowingID: following.ID}
+	if err := h.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&request).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to send follow request",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Follow request sent",
+		"pending": true,
+	})
+}
+
+func acceptFollowRequest(tx *gorm.DB, request models.FollowRequest) error {
+	if err := addFollow(tx, request.FollowerID, request.FollowingID); err != nil {
+		return err
+	}
+	return tx.Delete(&request).Error
+}
+
+func approveAllFollowRequests(tx *gorm.DB, userID uint) error {
+	var requests []models.FollowRequest
+	if err := tx.Where("following_id = ?", userID).Find(&requests).Error; err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if err := acceptFollowRequest(tx, request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFollowRequests lists the pending requests to follow the logged in user.
+func (h *UserHandler) GetFollowRequests(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var requests []models.FollowRequest
+	err := h.DB.
+		Preload("Follower").
+		Where("following_id = ?", userID).
+		Order("created_at").
+		Find(&requests).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch follow requests",
+			"error":   err.Error(),
+		})
+	}
+
+	type followRequest struct {
+		ID        uint      `json:"id"`
+		Follower  UserView  `json:"follower"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	response := make([]followRequest, 0, len(requests))
+	for _, request := range requests {
+		response = append(response, followRequest{
+			ID:        request.ID,
+			Follower:  publicView(request.Follower),
+			CreatedAt: request.CreatedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"requests": response,
+	})
+}
+
+func (h *UserHandler) findFollowRequest(c *fiber.Ctx) (*models.FollowRequest, error) {
+	userID := c.Locals("user_id").(uint)
+
+	var request models.FollowRequest
+	err := h.DB.Where("id = ? AND following_id = ?", c.Params("id"), userID).First(&request).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Follow request not found",
+			})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+	return &request, nil
+}
+
+func (h *UserHandler) ApproveFollowRequest(c *fiber.Ctx) error {
+	request, err := h.findFollowRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return acceptFollowRequest(tx, *request)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to approve follow request",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Follow request approved",
+	})
+}
+
+func (h *UserHandler) RejectFollowRequest(c *fiber.Ctx) error {
+	request, err := h.findFollowRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if err := h.DB.Delete(request).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to reject follow request",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Follow request rejected",
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"github.com-Personal/go-fiber/internal/models"
+	"gorm.io/gorm"
+)
+
+// addFollow records a follow and bumps the counters of both users. Following
+// someone twice is a no-op.
+func addFollow(tx *gorm.DB, followerID, followingID uint) error {
+	result := tx.Exec(
+		"INSERT INTO user_followers (follower_id, following_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		followerID, followingID,
+	)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return adjustFollowCounts(tx, followerID, followingID, 1)
+}
+
+// removeFollow deletes a follow, if there is one, and updates the counters.
+func removeFollow(tx *gorm.DB, followerID, followingID uint) error {
+	result := tx.Exec(
+		"DELETE FROM user_followers WHERE follower_id = ? AND following_id = ?",
+		followerID, followingID,
+	)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return adjustFollowCounts(tx, followerID, followingID, -1)
+}
+
+func adjustFollowCounts(tx *gorm.DB, followerID, followingID uint, delta int) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", followerID).
+		UpdateColumn("following_count", gorm.Expr("following_count + ?", delta)).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", followingID).
+		UpdateColumn("followers_count", gorm.Expr("followers_count + ?", delta)).Error
+}
+
+// removeAllFollows deletes every follow to and from a user, updating the
+// counters of the users on the other side.
+func removeAllFollows(tx *gorm.DB, userID uint) error {
+	if err := tx.Exec(
+		"UPDATE users SET followers_count = followers_count - 1 "+
+			"WHERE id IN (SELECT following_id FROM user_followers WHERE follower_id = ?)",
+		userID,
+	).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(
+		"UPDATE users SET following_count = following_count - 1 "+
+			"WHERE id IN (SELECT follower_id FROM user_followers WHERE following_id = ?)",
+		userID,
+	).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM user_followers WHERE follower_id = ? OR following_id = ?", userID, userID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{"followers_count": 0, "following_count": 0}).Error
+}
+
+// adjustPostsCount changes the number of published posts counted for a user.
+func adjustPostsCount(tx *gorm.DB, userID uint, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("posts_count", gorm.Expr("posts_count + ?", delta)).Error
+}
+
+// relationships reports, for each of the given users, whether the viewer
+// follows them and whether they follow the viewer.
+func relationships(db *gorm.DB, viewerID uint, userIDs []uint) (following, followedBy map[uint]bool, err error) {
+	following = map[uint]bool{}
+	followedBy = map[uint]bool{}
+	if len(userIDs) == 0 {
+		return following, followedBy, nil
+	}
+
+	var ids []uint
+	if err := db.Table("user_followers").
+		Where("follower_id = ? AND following_id IN ?", viewerID, userIDs).
+		Pluck("following_id", &ids).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, id := range ids {
+		following[id] = true
+	}
+
+	ids = nil
+	if err := db.Table("user_followers").
+		Where("following_id = ? AND follower_id IN ?", viewerID, userIDs).
+		Pluck("follower_id", &ids).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, id := range ids {
+		followedBy[id] = true
+	}
+
+	return following, followedBy, nil
+}
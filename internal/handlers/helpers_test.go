@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/loginguard"
+	"github.com-Personal/go-fiber/internal/mailer"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testUserHeader names the user a test request is made as, standing in for
+// AuthMiddleware.
+const testUserHeader = "X-Test-User"
+
+// newTestDB opens an in-memory database with models migrated. Handlers are
+// written for Postgres, so only those whose queries SQLite also understands
+// are tested this way.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	// Every connection to :memory: gets a database of its own.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+// sentMail collects the messages handlers send.
+type sentMail struct {
+	messages []mailer.Message
+}
+
+func (m *sentMail) Send(msg mailer.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// newTestUserHandler sets up a UserHandler that signs tokens with a test
+// secret and keeps login attempts in memory.
+func newTestUserHandler(t *testing.T, db *gorm.DB) *UserHandler {
+	t.Helper()
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	return NewUserHandler(db, &sentMail{}, loginguard.New(loginguard.NewMemoryStore(), loginguard.DefaultConfig()), "https://blog.example")
+}
+
+// newTestApp returns an app whose requests run as the user named in
+// testUserHeader, if any.
+func newTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id, err := strconv.ParseUint(c.Get(testUserHeader), 10, 64); err == nil {
+			c.Locals("user_id", uint(id))
+		}
+		return c.Next()
+	})
+	return app
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, user models.User) models.User {
+	t.Helper()
+	if user.Password == "" {
+		user.Password = "$2a$10$not.a.real.hash"
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+// createSquattedAccount registers the email address of someone else without
+// verifying it, the way an attacker would before its owner signs up, and
+// leaves a password, two-factor authentication, a session and an access
+// token on the account.
+func createSquattedAccount(t *testing.T, db *gorm.DB, username, email string) models.User {
+	t.Helper()
+	enabled := time.Now()
+	user := createTestUser(t, db, models.User{
+		Username:      username,
+		Email:         email,
+		Password:      "$2a$10$attacker.chosen.password",
+		TOTPSecret:    "ATTACKERSECRET",
+		TOTPEnabledAt: &enabled,
+	})
+	db.Create(&models.Session{ID: "squatter-session", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	db.Create(&models.PersonalAccessToken{UserID: user.ID, Name: "squatter", Prefix: "pat", TokenHash: "squatter-hash"})
+	db.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: "squatter-code"})
+	return user
+}
+
+// expectClaimed checks that nothing the squatter set up on an account still
+// signs in.
+func expectClaimed(t *testing.T, db *gorm.DB, userID uint) {
+	t.Helper()
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hasUsablePassword(user) || user.TOTPEnabledAt != nil || user.EmailVerifiedAt == nil {
+		t.Fatalf("account was linked without being claimed: %+v", user)
+	}
+	var session models.Session
+	db.First(&session, "id = ?", "squatter-session")
+	if session.RevokedAt == nil {
+		t.Fatal("the squatter's session is still live")
+	}
+	var live int64
+	db.Model(&models.PersonalAccessToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&live)
+	if live != 0 {
+		t.Fatalf("%d of the squatter's access tokens still live", live)
+	}
+	db.Model(&models.RecoveryCode{}).Where("user_id = ?", userID).Count(&live)
+	if live != 0 {
+		t.Fatalf("%d of the squatter's recovery codes left", live)
+	}
+}
+
+func asUser(req *http.Request, userID uint) *http.Request {
+	req.Header.Set(testUserHeader, itoa(userID))
+	return req
+}
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// send runs req through app and decodes the JSON response body, if any.
+func send(t *testing.T, app *fiber.App, req *http.Request) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	var body map[string]interface{}
+	if len(raw) > 0 && json.Unmarshal(raw, &body) != nil {
+		t.Fatalf("%s %s: response is not a JSON object: %s", req.Method, req.URL, raw)
+	}
+	return resp, body
+}
+
+func expectStatus(t *testing.T, resp *http.Response, body map[string]interface{}, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d; body: %v", resp.StatusCode, status, body)
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	Keys *utils.KeyRing
+}
+
+func NewJWKSHandler(keys *utils.KeyRing) *JWKSHandler {
+	return &JWKSHandler{Keys: keys}
+}
+
+func (h *JWKSHandler) GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(utils.JWKSMaxAge.Seconds())))
+	return c.Status(fiber.StatusOK).JSON(h.Keys.JWKS())
+}
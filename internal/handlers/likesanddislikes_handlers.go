@@ -19,6 +19,10 @@ func NewLikesandDislikes(db *gorm.DB) *LikesandDislikes {
 func (h *LikesandDislikes) GetReaction(c *fiber.Ctx) error {
 	postID := c.Params("post_id")
 
+	if hidden, err := postNotVisible(h.DB, c, postID); hidden {
+		return err
+	}
+
 	var reactions []models.LikesandDislikes
 
 	result := h.DB.Where("post_id = ?", postID).Find(&reactions)
@@ -56,44 +60,30 @@ func (h *LikesandDislikes) LikePost(c *fiber.Ctx) error {
 		})
 	}
 
+	if hidden, err := postNotVisible(h.DB, c, num); hidden {
+		return err
+	}
+
 	userID := c.Locals("user_id").(uint)
 	reaction.UserID = userID
 	reaction.PostID = uint(num)
 	reaction.ReactionType = "like"
 
-	var existingReaction models.LikesandDislikes
-
-	result := h.DB.Where("user_id = ? AND post_id = ? AND reaction_type = ?", userID, num, "like").First(&existingReaction)
-	if result.RowsAffected > 0 {
-		deleteResult := h.DB.Delete(&existingReaction)
-		if deleteResult.Error != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Unable to remove reaction",
-				"error":   deleteResult.Error.Error(),
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"message": "Reaction removed successfully",
+	var added bool
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		added, err = toggleReaction(tx, &reaction)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update reaction",
+			"error":   err.Error(),
 		})
 	}
 
-	dislikeResult := h.DB.Where("user_id = ? AND post_id = ? AND reaction_type = ?", userID, num, "dislike").First(&existingReaction)
-	if dislikeResult.RowsAffected > 0 {
-		deleteResult := h.DB.Delete(&existingReaction)
-		if deleteResult.Error != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Unable to remove reaction",
-				"error":   deleteResult.Error.Error(),
-			})
-		}
-	}
-
-	createResult := h.DB.Create(&reaction)
-	if createResult.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to add reaction",
-			"error":   createResult.Error.Error(),
+	if !added {
+		return c.JSON(fiber.Map{
+			"message": "Reaction removed successfully",
 		})
 	}
 
@@ -119,44 +109,30 @@ func (h *LikesandDislikes) DisLikePost(c *fiber.Ctx) error {
 		})
 	}
 
+	if hidden, err := postNotVisible(h.DB, c, num); hidden {
+		return err
+	}
+
 	userID := c.Locals("user_id").(uint)
 	reaction.UserID = userID
 	reaction.PostID = uint(num)
 	reaction.ReactionType = "dislike"
 
-	var existingReaction models.LikesandDislikes
-
-	result := h.DB.Where("user_id = ? AND post_id = ? AND reaction_type = ?", userID, num, "dislike").First(&existingReaction)
-	if result.RowsAffected > 0 {
-		deleteResult := h.DB.Delete(&existingReaction)
-		if deleteResult.Error != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Unable to remove reaction",
-				"error":   deleteResult.Error.Error(),
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"message": "Reaction removed successfully",
+	var added bool
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		added, err = toggleReaction(tx, &reaction)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update reaction",
+			"error":   err.Error(),
 		})
 	}
 
-	likeResult := h.DB.Where("user_id = ? AND post_id = ? AND reaction_type = ?", userID, num, "like").First(&existingReaction)
-	if likeResult.RowsAffected > 0 {
-		deleteResult := h.DB.Delete(&existingReaction)
-		if deleteResult.Error != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Unable to remove reaction",
-				"error":   deleteResult.Error.Error(),
-			})
-		}
-	}
-
-	createResult := h.DB.Create(&reaction)
-	if createResult.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to add reaction",
-			"error":   createResult.Error.Error(),
+	if !added {
+		return c.JSON(fiber.Map{
+			"message": "Reaction removed successfully",
 		})
 	}
 
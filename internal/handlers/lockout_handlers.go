@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com-Personal/go-fiber/internal/loginguard"
+	"github.com-Personal/go-fiber/internal/mailer"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// loginThrottled answers 429 with a Retry-After header when the account or
+// client IP is backing off or locked, and reports whether it did so.
+func (h *UserHandler) loginThrottled(c *fiber.Ctx, email string) (bool, error) {
+	retryAfter, err := h.Guard.RetryAfter(loginguard.AccountKey(email), loginguard.IPKey(c.IP()))
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check login attempts",
+			"error":   err.Error(),
+		})
+	}
+	if retryAfter <= 0 {
+		return false, nil
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return true, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message":     "Too many failed login attempts. Try again later",
+		"retry_after": seconds,
+	})
+}
+
+// recordLoginFailure counts a failed attempt against the account and the
+// client IP. When the account gets locked the owner is emailed an unlock link.
+func (h *UserHandler) recordLoginFailure(c *fiber.Ctx, email string, user *models.User) {
+	ip := c.IP()
+
+	locked, err := h.Guard.FailAccount(email)
+	if err != nil {
+		log.Printf("failed to record login failure: %v", err)
+	}
+	if locked {
+		var userID *uint
+		if user != nil {
+			userID = &user.ID
+		}
+		recordAudit(h.DB, userID, models.AuditAccountLocked, ip, "email="+email)
+
+		if user != nil {
+			if err := h.sendUnlockEmail(c, *user); err != nil {
+				log.Printf("failed to send unlock email to user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	ipLocked, err := h.Guard.FailIP(ip)
+	if err != nil {
+		log.Printf("failed to record login failure: %v", err)
+	}
+	if ipLocked {
+		recordAudit(h.DB, nil, models.AuditIPLocked, ip, "")
+	}
+}
+
+func (h *UserHandler) sendUnlockEmail(c *fiber.Ctx, user models.User) error {
+	token, err := createUserToken(h.DB, user.ID, models.AccountUnlockToken, h.Guard.Config.LockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	link := h.BaseURL + "/unlock-account?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe locked your account after several failed login attempts. It unlocks automatically in %s, or you can unlock it now:\n\n%s\n\nIf these attempts weren't you, consider changing your password.\n",
+			user.Username, h.Guard.Config.LockoutDuration, link),
+	})
+}
+
+func (h *UserHandler) UnlockAccount(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unlock token is required",
+		})
+	}
+
+	var user models.User
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := consumeUserToken(tx, token, models.AccountUnlockToken)
+		if err != nil {
+			return err
+		}
+		return tx.First(&user, stored.UserID).Error
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidUserToken) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid or expired unlock token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to unlock account",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := h.Guard.ResetAccount(user.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to unlock account",
+			"error":   err.Error(),
+		})
+	}
+	recordAudit(h.DB, &user.ID, models.AuditAccountUnlocked, c.IP(), "")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account unlocked. You can log in again",
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageSize reads the limit query parameter, clamped to maxPageSize.
+func pageSize(c *fiber.Ctx) int {
+	limit := c.QueryInt("limit", defaultPageSize)
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// encodeCursor turns the sort key of the last row of a page into an opaque
+// token for the next request.
+func encodeCursor(key interface{}) string {
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor reads the cursor query parameter into key. It reports false
+// when there is no cursor, i.e. for the first page.
+func decodeCursor(c *fiber.Ctx, key interface{}) (bool, error) {
+	cursor := c.Query("cursor")
+	if cursor == "" {
+		return false, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, key)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/mailer"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = time.Hour
+
+// RequestPasswordReset always answers the same way so it can't be used to
+// find out which emails are registered.
+func (h *UserHandler) RequestPasswordReset(c *fiber.Ctx) error {
+	var data struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if data.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Email is required",
+		})
+	}
+
+	var user models.User
+	err := h.DB.Where("email = ?", data.Email).First(&user).Error
+	if err == nil {
+		if err := h.sendPasswordResetEmail(c, user); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+func (h *UserHandler) sendPasswordResetEmail(c *fiber.Ctx, user models.User) error {
+	token, err := createUserToken(h.DB, user.ID, models.PasswordResetToken, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := h.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return h.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. If you didn't ask for this, you can ignore this email.\n",
+			user.Username, link, passwordResetTTL),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out of every existing session.
+func (h *UserHandler) ResetPassword(c *fiber.Ctx) error {
+	var data struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if data.Token == "" || data.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Token and new password are required",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to hash password",
+			"error":   err.Error(),
+		})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := consumeUserToken(tx, data.Token, models.PasswordResetToken)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", stored.UserID).
+			Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		return revokeAllSessions(tx, stored.UserID)
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidUserToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid or expired reset token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to reset password",
+			"error":   err.Error(),
+		})
+	}
+
+	clearRefreshTokenCookie(c)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset successful",
+	})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The reset link is built from the configured base URL, so a request with a
+// forged Host header can't have the token mailed to the attacker's site.
+func TestPasswordResetLinkIgnoresHostHeader(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.UserToken{})
+	h := newTestUserHandler(t, db)
+	app := newTestApp()
+	app.Post("/forgot-password", h.RequestPasswordReset)
+	createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+
+	req := httptest.NewRequest(http.MethodPost, "/forgot-password", strings.NewReader(`{"email":"alice@example.com"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Host = "attacker.example"
+	resp, body := send(t, app, req)
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	mail := h.Mailer.(*sentMail).messages
+	if len(mail) != 1 {
+		t.Fatalf("%d emails sent, want 1", len(mail))
+	}
+	if !strings.Contains(mail[0].Body, "https://blog.example/reset-password?token=") || strings.Contains(mail[0].Body, "attacker.example") {
+		t.Fatalf("reset email doesn't link to the configured base URL:\n%s", mail[0].Body)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxPersonalAccessTokenDays = 365
+
+func (h *UserHandler) CreatePersonalAccessToken(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if data.Name == "" || len(data.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Name and at least one scope are required",
+		})
+	}
+	for _, scope := range data.Scopes {
+		if !policy.ValidScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Unknown scope: " + scope,
+			})
+		}
+	}
+	if data.ExpiresInDays < 0 || data.ExpiresInDays > maxPersonalAccessTokenDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "expires_in_days must be between 0 (never) and 365",
+		})
+	}
+
+	random, err := utils.GenerateRandomToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to generate token",
+			"error":   err.Error(),
+		})
+	}
+	token := models.PersonalAccessTokenPrefix + random
+
+	pat := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      data.Name,
+		Prefix:    token[:len(models.PersonalAccessTokenPrefix)+6],
+		TokenHash: utils.HashToken(token),
+		Scopes:    data.Scopes,
+	}
+	if data.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, data.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	if err := h.DB.Create(&pat).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create token",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Token created. Copy it now, it will not be shown again",
+		"token":   token,
+		"details": pat,
+	})
+}
+
+func (h *UserHandler) GetPersonalAccessTokens(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var tokens []models.PersonalAccessToken
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch tokens",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"tokens": tokens,
+	})
+}
+
+func (h *UserHandler) RevokePersonalAccessToken(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var pat models.PersonalAccessToken
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&pat).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Token not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if pat.RevokedAt == nil {
+		if err := h.DB.Model(&pat).Update("revoked_at", time.Now()).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to revoke token",
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Token revoked successfully",
+	})
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
 	"github.com-Personal/go-fiber/internal/utils"
 	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
 	"github.com/gofiber/fiber/v2"
@@ -31,14 +34,47 @@ func (h *PostHandler) GetImage(c *fiber.Ctx) error {
 	return c.SendFile(filepath)
 }
 
+// GetPosts returns one page of the posts the viewer may see, newest first
+// unless sort asks for the most viewed or most liked.
 func (h *PostHandler) GetPosts(c *fiber.Ctx) error {
+	viewerID := c.Locals("user_id").(uint)
+
+	sort := c.Query("sort", "newest")
+	column, ok := postSortColumn(sort, listedStatus(c))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "sort must be one of newest, views or likes",
+		})
+	}
+
+	filters, err := postFilters(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid filter",
+			"error":   err.Error(),
+		})
+	}
+
+	var cursor postCursor
+	hasCursor, err := decodeCursor(c, &cursor)
+	if err != nil || (hasCursor && cursor.Sort != sort) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid cursor",
+		})
+	}
+
+	limit := pageSize(c)
+	query := h.DB.Scopes(listedPosts(viewerID), filters)
+	if hasCursor {
+		query = query.Scopes(cursor.after(column))
+	}
+
 	var posts []models.Post
-	result := h.DB.
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email", "bio", "avatar_url", "created_at")
-		}).
-		Preload("Comments").
-		Preload("LikesandDislikes").
+	result := query.
+		Preload("User", withDeletedUsers).
+		Order(column + " DESC").
+		Order("posts.id DESC").
+		Limit(limit + 1).
 		Find(&posts)
 
 	if result.Error != nil {
@@ -47,7 +83,23 @@ func (h *PostHandler) GetPosts(c *fiber.Ctx) error {
 			"error":   result.Error.Error(),
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(posts)
+
+	var nextCursor *string
+	if len(posts) > limit {
+		posts = posts[:limit]
+		encoded := encodeCursor(newPostCursor(sort, posts[limit-1]))
+		nextCursor = &encoded
+	}
+
+	summaries := make([]PostSummary, 0, len(posts))
+	for _, post := range posts {
+		summaries = append(summaries, summarizePost(post))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"posts":       summaries,
+		"next_cursor": nextCursor,
+	})
 }
 
 func (h *PostHandler) NewPost(c *fiber.Ctx) error {
@@ -72,6 +124,22 @@ func (h *PostHandler) NewPost(c *fiber.Ctx) error {
 		})
 	}
 
+	// Posts are created as drafts or published right away; scheduling goes
+	// through POST /posts/:id/schedule.
+	switch newPost.Status {
+	case "", models.PostDraft:
+		newPost.Status = models.PostDraft
+		newPost.PublishedAt = nil
+	case models.PostPublished:
+		now := time.Now()
+		newPost.PublishedAt = &now
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "status must be draft or published",
+		})
+	}
+	newPost.ScheduledFor = nil
+
 	tags := c.FormValue("tags")
 	if tags == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -80,8 +148,6 @@ func (h *PostHandler) NewPost(c *fiber.Ctx) error {
 	}
 	newPost.Tags = strings.Split(tags, ",")
 
-	newPost.Slug = utils.CreateSlug(newPost.Title)
-
 	imageURL, fileName, err := firebase_utils.UploadFileToFirebaseAndGetURL(c, "image", "uploads")
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -94,13 +160,35 @@ func (h *PostHandler) NewPost(c *fiber.Ctx) error {
 	newPost.FeaturedImageUrl = imageURL
 
 	newPost.ViewCount = 0
+	newPost.LikesCount = 0
+	newPost.DislikesCount = 0
+	newPost.CommentsCount = 0
 
 	var user models.User
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockAuthor(tx, userID); err != nil {
+			return err
+		}
+		slug, err := uniquePostSlug(tx, userID, 0, utils.CreateSlug(newPost.Title))
+		if err != nil {
+			return err
+		}
+		newPost.Slug = slug
+
 		if err := tx.Create(newPost).Error; err != nil {
 			return err
 		}
 
+		if err := recordRevision(tx, *newPost, userID, nil); err != nil {
+			return err
+		}
+
+		if newPost.Status == models.PostPublished {
+			if err := adjustPostsCount(tx, userID, 1); err != nil {
+				return err
+			}
+		}
+
 		if err := tx.First(&user, userID).Error; err != nil {
 			return err
 		}
@@ -117,14 +205,7 @@ func (h *PostHandler) NewPost(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"post": newPost,
-		"user": fiber.Map{
-			"id":         user.ID,
-			"username":   user.Username,
-			"email":      user.Email,
-			"bio":        user.Bio,
-			"avatar_url": user.AvatarURL,
-			"created_at": user.CreatedAt,
-		},
+		"user": selfView(user),
 	})
 }
 
@@ -146,7 +227,14 @@ func (h *PostHandler) UpdatePost(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("user_id").(uint)
-	if post.UserID != userID {
+	role, err := currentRole(h.DB, c, post.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
+	if !policy.CanEditPost(role, userID, post) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "You are not authorized to update this post",
 		})
@@ -165,11 +253,46 @@ func (h *PostHandler) UpdatePost(c *fiber.Ctx) error {
 		})
 	}
 
-	updateResult := h.DB.Model(&post).Omit("UserID", "ViewCount").Updates(updatedPost)
-	if updateResult.Error != nil {
+	// Every save is kept as a revision, so an edit can always be undone. The
+	// slug only changes when one is asked for, not with the title.
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPost(tx, &post); err != nil {
+			return err
+		}
+		if updatedPost.Slug != "" {
+			if slug := utils.CreateSlug(updatedPost.Slug); slug != post.Slug {
+				if err := lockAuthor(tx, post.UserID); err != nil {
+					return err
+				}
+				taken, err := postSlugTaken(tx, post.UserID, post.ID, slug)
+				if err != nil {
+					return err
+				}
+				if taken {
+					return errSlugTaken
+				}
+				if err := changePostSlug(tx, &post, slug); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Model(&post).Omit("UserID", "Slug", "ViewCount", "LikesCount", "DislikesCount", "CommentsCount", "Status", "PublishedAt", "ScheduledFor").Updates(updatedPost).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&post, post.ID).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, post, userID, nil)
+	})
+	if errors.Is(err, errSlugTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Slug is already used by another of your posts",
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to update Post",
-			"error":   updateResult.Error.Error(),
+			"error":   err.Error(),
 		})
 	}
 	return c.JSON(post)
@@ -193,17 +316,41 @@ func (h *PostHandler) DeletePost(c *fiber.Ctx) error {
 	}
 
 	userID := c.Locals("user_id").(uint)
-	if post.UserID != userID {
+	role, err := currentRole(h.DB, c, post.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
+	if !policy.CanDeletePost(role, userID, post) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "You are not authorized to delete this post",
 		})
 	}
 
-	deleteResult := h.DB.Delete(&post)
-	if deleteResult.Error != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("status = ?", post.Status).Delete(&post)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPostStatusChanged
+		}
+		if post.Status != models.PostPublished {
+			return nil
+		}
+		return adjustPostsCount(tx, post.UserID, -1)
+	})
+	if errors.Is(err, errPostStatusChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "The post's status changed in the meantime, please try again",
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Unable to delete Post",
-			"error":   deleteResult.Error.Error(),
+			"error":   err.Error(),
 		})
 	}
 	return c.JSON(fiber.Map{
@@ -213,12 +360,45 @@ func (h *PostHandler) DeletePost(c *fiber.Ctx) error {
 
 func (h *PostHandler) GetPostsByUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
+
+	var owner models.User
+	if err := h.DB.Unscoped().First(&owner, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+	viewerID := c.Locals("user_id").(uint)
+	blocked, err := eitherBlocked(h.DB, viewerID, owner.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check blocks",
+			"error":   err.Error(),
+		})
+	}
+	if blocked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+	visible, err := canSeeContent(h.DB, viewerID, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check visibility",
+			"error":   err.Error(),
+		})
+	}
+	if !visible {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "This account is private",
+		})
+	}
+
 	var posts []models.Post
 	result := h.DB.
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email")
-		}).
-		Where("user_id = ?", userID).Find(&posts)
+		Preload("User", withDeletedUsers).
+		Where("user_id = ?", userID).
+		Where("(status = ? OR user_id = ?)", models.PostPublished, viewerID).
+		Find(&posts)
 
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -226,25 +406,35 @@ func (h *PostHandler) GetPostsByUser(c *fiber.Ctx) error {
 			"error":   result.Error.Error(),
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(posts)
+	views := make([]PostView, 0, len(posts))
+	for _, post := range posts {
+		views = append(views, viewPost(post))
+	}
+	return c.Status(fiber.StatusOK).JSON(views)
 }
 
 func (h *PostHandler) GetPostBySlug(c *fiber.Ctx) error {
 	username := c.Params("username")
-	slug := c.Params("slug")
+	slug := slugParam(c)
+
+	viewerID := c.Locals("user_id").(uint)
 
 	var post models.Post
 	postResult := h.DB.
-		Preload("User", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "username", "email")
-		}).
-		Preload("User").
+		Preload("User", withDeletedUsers).
 		Joins("JOIN users ON posts.user_id = users.id").
 		Where("users.username = ? AND posts.slug = ?", username, slug).
+		Scopes(visiblePosts(viewerID), withoutBlockedUsers("posts.user_id", viewerID)).
 		First(&post)
 
 	if postResult.Error != nil {
 		if postResult.Error == gorm.ErrRecordNotFound {
+			if redirected, err := h.redirectOldSlug(c, username, slug); redirected {
+				return err
+			}
+			if redirected, err := h.redirectRenamedAuthor(c, username); redirected {
+				return err
+			}
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Post not found",
 			})
@@ -261,5 +451,20 @@ func (h *PostHandler) GetPostBySlug(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(post)
+	return c.Status(fiber.StatusOK).JSON(viewPost(post))
+}
+
+// redirectRenamedAuthor redirects a post link that uses an old username,
+// unless someone still has that name.
+func (h *PostHandler) redirectRenamedAuthor(c *fiber.Ctx, username string) (bool, error) {
+	var count int64
+	if err := h.DB.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve post",
+		})
+	}
+	if count > 0 {
+		return false, nil
+	}
+	return redirectRenamed(h.DB, c, username)
 }
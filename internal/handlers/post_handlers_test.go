@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func newPostReadTest(t *testing.T) (*gorm.DB, *fiber.App, models.User) {
+	t.Helper()
+
+	db := newTestDB(t, &models.User{}, &models.Post{}, &models.PostSlugHistory{},
+		&models.UsernameHistory{}, &models.UserBlock{}, &models.UserMute{},
+		&models.Comment{}, &models.LikesandDislikes{})
+	h := NewPostHandler(db)
+	app := newTestApp()
+	// Registered in the order of cmd/server, where the post routes by id
+	// come before the one by username and slug.
+	comments := NewCommentHandler(db)
+	app.Get("/posts/:id/comments", comments.GetCommentsandCount)
+	app.Post("/posts/:id/comments", comments.AddComment)
+	reactions := NewLikesandDislikes(db)
+	app.Get("/posts/:post_id/reactions", reactions.GetReaction)
+	app.Post("/posts/:id/like", reactions.LikePost)
+	app.Post("/posts/:id/dislike", reactions.DisLikePost)
+	app.Get("/posts", h.GetPosts)
+	app.Get("/posts/:username/:slug", h.GetPostBySlug)
+	app.Get("/users/:id/posts", h.GetPostsByUser)
+
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com", DisplayName: "Alice"})
+	post := models.Post{Title: "Hello", Content: "<p>Hi</p>", Slug: "hello", UserID: alice.ID, Status: models.PostPublished}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, app, alice
+}
+
+func getAs(t *testing.T, app *fiber.App, target string, userID uint) int {
+	t.Helper()
+	return requestAs(t, app, http.MethodGet, target, userID)
+}
+
+func requestAs(t *testing.T, app *fiber.App, method, target string, userID uint) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(`{"comment":"Hi"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(asUser(req, userID), -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBlockedUsersCantReadEachOthersPosts(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	carol := createTestUser(t, db, models.User{Username: "carol", Email: "carol@example.com"})
+	db.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+	db.Create(&models.UserBlock{BlockerID: carol.ID, BlockedID: alice.ID})
+
+	for _, viewer := range []models.User{bob, carol} {
+		if status := getAs(t, app, "/posts/alice/hello", viewer.ID); status != fiber.StatusNotFound {
+			t.Errorf("%s got alice's post: status %d", viewer.Username, status)
+		}
+		if status := getAs(t, app, "/users/"+itoa(alice.ID)+"/posts", viewer.ID); status != fiber.StatusNotFound {
+			t.Errorf("%s got alice's posts: status %d", viewer.Username, status)
+		}
+	}
+}
+
+func TestBlockedUsersCantReachPostsByID(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	carol := createTestUser(t, db, models.User{Username: "carol", Email: "carol@example.com"})
+	db.Create(&models.UserBlock{BlockerID: alice.ID, BlockedID: bob.ID})
+	db.Create(&models.UserBlock{BlockerID: carol.ID, BlockedID: alice.ID})
+
+	var post models.Post
+	db.First(&post, "slug = ?", "hello")
+	id := itoa(post.ID)
+	routes := []struct{ method, target string }{
+		{http.MethodGet, "/posts/" + id + "/comments"},
+		{http.MethodPost, "/posts/" + id + "/comments"},
+		{http.MethodGet, "/posts/" + id + "/reactions"},
+		{http.MethodPost, "/posts/" + id + "/like"},
+		{http.MethodPost, "/posts/" + id + "/dislike"},
+	}
+	for _, viewer := range []models.User{bob, carol} {
+		for _, route := range routes {
+			if status := requestAs(t, app, route.method, route.target, viewer.ID); status != fiber.StatusNotFound {
+				t.Errorf("%s: %s %s = %d, want 404", viewer.Username, route.method, route.target, status)
+			}
+		}
+	}
+
+	dave := createTestUser(t, db, models.User{Username: "dave", Email: "dave@example.com"})
+	if status := getAs(t, app, "/posts/"+id+"/comments", dave.ID); status != fiber.StatusOK {
+		t.Errorf("dave: GET comments = %d, want 200", status)
+	}
+
+	// The same requests for a post that doesn't exist get the same answer.
+	if status := requestAs(t, app, http.MethodPost, "/posts/999/like", bob.ID); status != fiber.StatusNotFound {
+		t.Errorf("liking a missing post = %d, want 404", status)
+	}
+}
+
+func TestMutedUsersPostsCanStillBeRead(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	db.Create(&models.UserMute{MuterID: bob.ID, MutedID: alice.ID})
+
+	if status := getAs(t, app, "/posts/alice/hello", bob.ID); status != fiber.StatusOK {
+		t.Errorf("GET alice's post: status %d, want 200", status)
+	}
+	if status := getAs(t, app, "/users/"+itoa(alice.ID)+"/posts", bob.ID); status != fiber.StatusOK {
+		t.Errorf("GET alice's posts: status %d, want 200", status)
+	}
+}
+
+func TestPostAuthorIsPublicView(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+
+	expectPublicAuthor := func(post map[string]interface{}) {
+		t.Helper()
+		if post["content"] != "<p>Hi</p>" {
+			t.Errorf("content = %v", post["content"])
+		}
+		author, _ := post["author"].(map[string]interface{})
+		if author["username"] != "alice" || author["display_name"] != "Alice" {
+			t.Errorf("author = %v", author)
+		}
+		for _, field := range []string{"email", "password", "role"} {
+			if _, ok := author[field]; ok {
+				t.Errorf("author includes %s", field)
+			}
+		}
+	}
+
+	resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts/alice/hello", nil), bob.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+	expectPublicAuthor(body)
+
+	resp, err := app.Test(asUser(httptest.NewRequest(http.MethodGet, "/users/"+itoa(alice.ID)+"/posts", nil), bob.ID), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var posts []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+	expectPublicAuthor(posts[0])
+}
+
+func TestPostsOfDeletedAuthorShowDeletedUser(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	if err := db.Delete(&alice).Error; err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	db.First(&post, "slug = ?", "hello")
+
+	expectDeletedAuthor := func(post map[string]interface{}) {
+		t.Helper()
+		author, _ := post["author"].(map[string]interface{})
+		if author["username"] != deletedUsername || author["display_name"] != "" {
+			t.Errorf("author = %v, want the deleted user view", author)
+		}
+	}
+
+	resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts", nil), bob.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+	posts, _ := body["posts"].([]interface{})
+	if len(posts) != 1 {
+		t.Fatalf("listed %d posts, want 1", len(posts))
+	}
+	expectDeletedAuthor(posts[0].(map[string]interface{}))
+
+	resp, body = send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts/alice/hello", nil), bob.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+	expectDeletedAuthor(body)
+
+	for _, target := range []string{"/users/" + itoa(alice.ID) + "/posts", "/posts/" + itoa(post.ID) + "/comments"} {
+		if status := getAs(t, app, target, bob.ID); status != fiber.StatusOK {
+			t.Errorf("GET %s = %d, want 200", target, status)
+		}
+	}
+}
+
+// A post written long before it was published is listed, paged and filtered
+// by when it went out rather than when its draft was started.
+func TestPublishedPostsGoByPublicationDate(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	db.Where("slug = ?", "hello").Delete(&models.Post{})
+
+	now := time.Now()
+	day := 24 * time.Hour
+	lastHour, fiveDaysAgo := now.Add(-time.Hour), now.Add(-5*day)
+	for _, post := range []models.Post{
+		{Slug: "long-scheduled", CreatedAt: now.Add(-10 * day), PublishedAt: &lastHour},
+		{Slug: "old-news", CreatedAt: fiveDaysAgo, PublishedAt: &fiveDaysAgo},
+	} {
+		post.Title, post.Content, post.UserID, post.Status = post.Slug, "<p>Hi</p>", alice.ID, models.PostPublished
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) ([]string, string) {
+		t.Helper()
+		resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts?"+query, nil), alice.ID))
+		expectStatus(t, resp, body, fiber.StatusOK)
+		var slugs []string
+		for _, post := range body["posts"].([]interface{}) {
+			slugs = append(slugs, post.(map[string]interface{})["slug"].(string))
+		}
+		cursor, _ := body["next_cursor"].(string)
+		return slugs, cursor
+	}
+
+	first, cursor := list("limit=1")
+	second, _ := list("limit=1&cursor=" + url.QueryEscape(cursor))
+	if got := append(first, second...); strings.Join(got, ",") != "long-scheduled,old-news" {
+		t.Errorf("newest pages = %v, want [long-scheduled old-news]", got)
+	}
+
+	if got, _ := list("from=" + now.Add(-2*day).Format("2006-01-02")); strings.Join(got, ",") != "long-scheduled" {
+		t.Errorf("from two days ago = %v, want [long-scheduled]", got)
+	}
+	if got, _ := list("to=" + url.QueryEscape(now.Add(-3*day).Format(time.RFC3339))); strings.Join(got, ",") != "old-news" {
+		t.Errorf("to three days ago = %v, want [old-news]", got)
+	}
+}
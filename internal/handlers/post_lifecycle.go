@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var postStatuses = map[string]bool{
+	models.PostDraft:     true,
+	models.PostScheduled: true,
+	models.PostPublished: true,
+	models.PostArchived:  true,
+}
+
+// postTransitions lists, for each status, the statuses a post may move to it
+// from. A scheduled post can be rescheduled.
+var postTransitions = map[string][]string{
+	models.PostDraft:     {models.PostScheduled, models.PostPublished, models.PostArchived},
+	models.PostScheduled: {models.PostDraft, models.PostScheduled},
+	models.PostPublished: {models.PostDraft, models.PostScheduled, models.PostArchived},
+	models.PostArchived:  {models.PostPublished},
+}
+
+// errPostStatusChanged reports that a post's status changed between reading
+// and updating it.
+var errPostStatusChanged = errors.New("post status changed")
+
+func canTransition(from, to string) bool {
+	for _, status := range postTransitions[to] {
+		if status == from {
+			return true
+		}
+	}
+	return false
+}
+
+// publishedDelta is how a move from one status to another changes the
+// author's posts_count, which only counts published posts.
+func publishedDelta(from, to string) int {
+	switch {
+	case from != models.PostPublished && to == models.PostPublished:
+		return 1
+	case from == models.PostPublished && to != models.PostPublished:
+		return -1
+	}
+	return 0
+}
+
+// PublishPost publishes a draft, scheduled or archived post right away. A
+// post that was published before keeps its original PublishedAt.
+func (h *PostHandler) PublishPost(c *fiber.Ctx) error {
+	return h.transitionPost(c, models.PostPublished, map[string]interface{}{
+		"published_at":  gorm.Expr("COALESCE(published_at, ?)", time.Now()),
+		"scheduled_for": nil,
+	})
+}
+
+// UnpublishPost takes a post back to draft, cancelling any schedule.
+func (h *PostHandler) UnpublishPost(c *fiber.Ctx) error {
+	return h.transitionPost(c, models.PostDraft, map[string]interface{}{
+		"published_at":  nil,
+		"scheduled_for": nil,
+	})
+}
+
+// SchedulePost has the scheduler publish a draft at scheduled_for, which has
+// to be in the future. Scheduling a scheduled post again moves it.
+func (h *PostHandler) SchedulePost(c *fiber.Ctx) error {
+	var body struct {
+		ScheduledFor *time.Time `json:"scheduled_for"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse the data",
+			"error":   err.Error(),
+		})
+	}
+	if body.ScheduledFor == nil || !body.ScheduledFor.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "scheduled_for must be a time in the future",
+		})
+	}
+
+	return h.transitionPost(c, models.PostScheduled, map[string]interface{}{
+		"scheduled_for": *body.ScheduledFor,
+	})
+}
+
+// ArchivePost hides a published post without deleting it.
+func (h *PostHandler) ArchivePost(c *fiber.Ctx) error {
+	return h.transitionPost(c, models.PostArchived, map[string]interface{}{
+		"scheduled_for": nil,
+	})
+}
+
+// transitionPost moves the post in the id param to status to, applying
+// updates along with it. The update only goes through if the status hasn't
+// changed since the post was read, so a post the scheduler publishes in the
+// meantime isn't moved from a state it is no longer in.
+func (h *PostHandler) transitionPost(c *fiber.Ctx, to string, updates map[string]interface{}) error {
+	var post models.Post
+	if failed, err := h.postNotEditable(c, &post); failed {
+		return err
+	}
+
+	if !canTransition(post.Status, to) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": fmt.Sprintf("A %s post cannot be made %s", post.Status, to),
+			"status":  post.Status,
+		})
+	}
+
+	updates["status"] = to
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Post{}).
+			Where("id = ? AND status = ?", post.ID, post.Status).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPostStatusChanged
+		}
+		return adjustPostsCount(tx, post.UserID, publishedDelta(post.Status, to))
+	})
+	if errors.Is(err, errPostStatusChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "The post's status changed in the meantime, please try again",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update Post",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := h.DB.Preload("User", withDeletedUsers).First(&post, post.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch Post",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post is now " + to,
+		"post":    summarizePost(post),
+	})
+}
+
+// postNotEditable loads the post in the id param into post and responds with
+// an error unless the caller may edit it. Posts other users can't see are
+// reported as missing.
+func (h *PostHandler) postNotEditable(c *fiber.Ctx, post *models.Post) (bool, error) {
+	if err := h.DB.First(post, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Post not found",
+			})
+		}
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch Post",
+			"error":   err.Error(),
+		})
+	}
+
+	userID := c.Locals("user_id").(uint)
+	role, err := currentRole(h.DB, c, post.UserID)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
+	if !policy.CanEditPost(role, userID, *post) {
+		if post.Status != models.PostPublished {
+			return true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Post not found",
+			})
+		}
+		return true, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "You are not authorized to update this post",
+		})
+	}
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPostsCountFollowsPublishedPosts(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.Post{})
+	h := NewPostHandler(db)
+	app := newTestApp()
+	app.Delete("/posts/:id", h.DeletePost)
+	app.Post("/posts/:id/publish", h.PublishPost)
+	app.Post("/posts/:id/unpublish", h.UnpublishPost)
+	app.Post("/posts/:id/schedule", h.SchedulePost)
+	app.Post("/posts/:id/archive", h.ArchivePost)
+
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+	post := models.Post{Title: "Hello", Slug: "hello", UserID: alice.ID, Status: models.PostDraft}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		method, action, body string
+		want                 int
+	}{
+		{http.MethodPost, "schedule", `{"scheduled_for":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`, 0},
+		{http.MethodPost, "unpublish", "", 0},
+		{http.MethodPost, "publish", "", 1},
+		{http.MethodPost, "archive", "", 0},
+		{http.MethodPost, "publish", "", 1},
+		{http.MethodDelete, "", "", 0},
+	}
+	for _, step := range steps {
+		target := "/posts/" + itoa(post.ID)
+		if step.action != "" {
+			target += "/" + step.action
+		}
+		req := httptest.NewRequest(step.method, target, strings.NewReader(step.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, body := send(t, app, asUser(req, alice.ID))
+		expectStatus(t, resp, body, fiber.StatusOK)
+
+		var user models.User
+		db.First(&user, alice.ID)
+		if user.PostsCount != step.want {
+			t.Fatalf("after %s %s: posts_count = %d, want %d", step.method, target, user.PostsCount, step.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// PostSummary is a post as shown in lists: no content and no nested
+// comments or reactions, just their counts.
+type PostSummary struct {
+	ID               uint       `json:"id"`
+	Title            string     `json:"title"`
+	Description      string     `json:"description"`
+	Slug             string     `json:"slug"`
+	Category         string     `json:"category"`
+	Tags             []string   `json:"tags"`
+	FeaturedImageUrl string     `json:"featuredImage_url"`
+	Status           string     `json:"status"`
+	PublishedAt      *time.Time `json:"published_at"`
+	ScheduledFor     *time.Time `json:"scheduled_for,omitempty"`
+	ViewCount        uint       `json:"view_count"`
+	LikesCount       int        `json:"likes_count"`
+	DislikesCount    int        `json:"dislikes_count"`
+	CommentsCount    int        `json:"comments_count"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Author           UserView   `json:"author"`
+}
+
+func summarizePost(post models.Post) PostSummary {
+	tags := []string(post.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return PostSummary{
+		ID:               post.ID,
+		Title:            post.Title,
+		Description:      post.Description,
+		Slug:             post.Slug,
+		Category:         post.Category,
+		Tags:             tags,
+		FeaturedImageUrl: post.FeaturedImageUrl,
+		Status:           post.Status,
+		PublishedAt:      post.PublishedAt,
+		ScheduledFor:     post.ScheduledFor,
+		ViewCount:        post.ViewCount,
+		LikesCount:       post.LikesCount,
+		DislikesCount:    post.DislikesCount,
+		CommentsCount:    post.CommentsCount,
+		CreatedAt:        post.CreatedAt,
+		Author:           publicView(post.User),
+	}
+}
+
+// PostView is a single post with its content.
+type PostView struct {
+	PostSummary
+	Content string `json:"content"`
+}
+
+func viewPost(post models.Post) PostView {
+	return PostView{PostSummary: summarizePost(post), Content: post.Content}
+}
+
+// postSorts maps the sort query parameter to the column posts are ordered
+// by, newest first within equal values. An empty column stands for
+// postDateColumn.
+var postSorts = map[string]string{
+	"newest": "",
+	"views":  "posts.view_count",
+	"likes":  "posts.likes_count",
+}
+
+// postSortColumn returns the column to order posts with the given status by.
+func postSortColumn(sort, status string) (string, bool) {
+	column, ok := postSorts[sort]
+	if ok && column == "" {
+		column = postDateColumn(status)
+	}
+	return column, ok
+}
+
+// postDateColumn is the date the newest sort and the from and to filters go
+// by. Published posts are dated by when they went public, so a scheduled
+// post isn't listed by when its draft was started; posts that were never
+// published only have their creation date.
+func postDateColumn(status string) string {
+	if status == models.PostPublished {
+		return "posts.published_at"
+	}
+	return "posts.created_at"
+}
+
+// postDate is a post's value of postDateColumn.
+func postDate(post models.Post) time.Time {
+	if post.Status == models.PostPublished && post.PublishedAt != nil {
+		return *post.PublishedAt
+	}
+	return post.CreatedAt
+}
+
+// listedStatus is the status query parameter, published by default.
+func listedStatus(c *fiber.Ctx) string {
+	return strings.TrimSpace(c.Query("status", models.PostPublished))
+}
+
+// postCursor is the sort key of the last post on a page. Sort is kept so a
+// cursor can't be used with a different order.
+type postCursor struct {
+	Sort  string    `json:"s"`
+	Date  time.Time `json:"t,omitempty"`
+	Count int64     `json:"n,omitempty"`
+	ID    uint      `json:"id"`
+}
+
+func newPostCursor(sort string, post models.Post) postCursor {
+	cursor := postCursor{Sort: sort, ID: post.ID}
+	switch sort {
+	case "newest":
+		cursor.Date = postDate(post)
+	case "views":
+		cursor.Count = int64(post.ViewCount)
+	case "likes":
+		cursor.Count = int64(post.LikesCount)
+	}
+	return cursor
+}
+
+// after limits a query to the posts that come after the cursor.
+func (p postCursor) after(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if p.Sort == "newest" {
+			return db.Where("("+column+", posts.id) < (?, ?)", p.Date, p.ID)
+		}
+		return db.Where("("+column+", posts.id) < (?, ?)", p.Count, p.ID)
+	}
+}
+
+// postFilters builds a scope from the category, tags, author, status, from
+// and to query parameters. tags is comma separated and matches posts with
+// all of them; status defaults to published, and other statuses only find
+// the viewer's own posts; from and to take a date or an RFC 3339 time, are
+// compared with postDateColumn, and a date in to includes that whole day.
+func postFilters(c *fiber.Ctx) (func(*gorm.DB) *gorm.DB, error) {
+	category := strings.TrimSpace(c.Query("category"))
+	author := strings.TrimSpace(c.Query("author"))
+	status := listedStatus(c)
+	if !postStatuses[status] {
+		return nil, errors.New("status must be one of draft, scheduled, published or archived")
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(c.Query("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	from, err := parseDateParam(c.Query("from"), false)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	to, err := parseDateParam(c.Query("to"), true)
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if category != "" {
+			db = db.Where("posts.category = ?", category)
+		}
+		if len(tags) > 0 {
+			db = db.Where("posts.tags @> ?", pq.StringArray(tags))
+		}
+		if author != "" {
+			db = db.Where("posts.user_id IN (SELECT id FROM users WHERE username = ?)", author)
+		}
+		db = db.Where("posts.status = ?", status)
+		if from != nil {
+			db = db.Where(postDateColumn(status)+" >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where(postDateColumn(status)+" < ?", *to)
+		}
+		return db
+	}, nil
+}
+
+// parseDateParam reads a date (2006-01-02) or an RFC 3339 time. As an
+// exclusive upper bound a date is moved to the start of the next day.
+func parseDateParam(value string, upperBound bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New("expected a date like 2006-01-02 or an RFC 3339 time")
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
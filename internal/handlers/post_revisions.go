@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/diff"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// diffContext is how many unchanged lines surround each change in a unified
+// diff.
+const diffContext = 3
+
+// RevisionView is a revision with its editor. Lists leave out the content.
+type RevisionView struct {
+	Number       int       `json:"number"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Content      string    `json:"content,omitempty"`
+	Tags         []string  `json:"tags"`
+	Editor       UserView  `json:"editor"`
+	RestoredFrom *int      `json:"restored_from"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func revisionView(revision models.PostRevision) RevisionView {
+	tags := []string(revision.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return RevisionView{
+		Number:       revision.Number,
+		Title:        revision.Title,
+		Description:  revision.Description,
+		Content:      revision.Content,
+		Tags:         tags,
+		Editor:       publicView(revision.Editor),
+		RestoredFrom: revision.RestoredFrom,
+		CreatedAt:    revision.CreatedAt,
+	}
+}
+
+type revisionCursor struct {
+	Number int `json:"n"`
+}
+
+// recordRevision stores the text post now has as its next revision. Callers
+// hold a lock on the post row, so numbers are handed out one at a time.
+func recordRevision(tx *gorm.DB, post models.Post, editorID uint, restoredFrom *int) error {
+	var last int
+	if err := tx.Model(&models.PostRevision{}).
+		Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.PostRevision{
+		PostID:       post.ID,
+		Number:       last + 1,
+		Title:        post.Title,
+		Description:  post.Description,
+		Content:      post.Content,
+		Tags:         post.Tags,
+		EditorID:     editorID,
+		RestoredFrom: restoredFrom,
+	}).Error
+}
+
+// lockPost reloads post for update within tx.
+func lockPost(tx *gorm.DB, post *models.Post) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(post, post.ID).Error
+}
+
+// findRevision loads revision number of postID, responding with 404 when
+// there is no such revision.
+func (h *PostHandler) findRevision(c *fiber.Ctx, postID uint, number int, revision *models.PostRevision) (bool, error) {
+	err := h.DB.Preload("Editor", withDeletedUsers).
+		Where("post_id = ? AND number = ?", postID, number).
+		First(revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": fmt.Sprintf("Revision %d not found", number),
+		})
+	}
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch revision",
+			"error":   err.Error(),
+		})
+	}
+	return false, nil
+}
+
+// GetRevisions lists a post's revisions, newest first, to the people who
+// may edit it.
+func (h *PostHandler) GetRevisions(c *fiber.Ctx) error {
+	var post models.Post
+	if failed, err := h.postNotEditable(c, &post); failed {
+		return err
+	}
+
+	var cursor revisionCursor
+	hasCursor, err := decodeCursor(c, &cursor)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid cursor",
+		})
+	}
+
+	limit := pageSize(c)
+	query := h.DB.Omit("content").Preload("Editor", withDeletedUsers).Where("post_id = ?", post.ID)
+	if hasCursor {
+		query = query.Where("number < ?", cursor.Number)
+	}
+
+	var revisions []models.PostRevision
+	if err := query.Order("number DESC").Limit(limit + 1).Find(&revisions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch revisions",
+			"error":   err.Error(),
+		})
+	}
+
+	var nextCursor *string
+	if len(revisions) > limit {
+		revisions = revisions[:limit]
+		encoded := encodeCursor(revisionCursor{Number: revisions[limit-1].Number})
+		nextCursor = &encoded
+	}
+
+	views := make([]RevisionView, 0, len(revisions))
+	for _, revision := range revisions {
+		views = append(views, revisionView(revision))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"revisions":   views,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetRevision returns one revision with its content.
+func (h *PostHandler) GetRevision(c *fiber.Ctx) error {
+	var post models.Post
+	if failed, err := h.postNotEditable(c, &post); failed {
+		return err
+	}
+
+	number, err := c.ParamsInt("number")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid revision number",
+		})
+	}
+
+	var revision models.PostRevision
+	if missing, err := h.findRevision(c, post.ID, number, &revision); missing {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(revisionView(revision))
+}
+
+// DiffRevisions compares revisions from and to of a post, by default the
+// latest one with the one before it. Revision 0 stands for an empty post, so
+// the first revision is compared with nothing. mode is unified (the default), a
+// unified diff over the title, description, tags and content, or words,
+// word-level edits for each field that changed.
+func (h *PostHandler) DiffRevisions(c *fiber.Ctx) error {
+	var post models.Post
+	if failed, err := h.postNotEditable(c, &post); failed {
+		return err
+	}
+
+	mode := c.Query("mode", "unified")
+	if mode != "unified" && mode != "words" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "mode must be unified or words",
+		})
+	}
+
+	to := c.QueryInt("to")
+	if to == 0 {
+		if err := h.DB.Model(&models.PostRevision{}).
+			Where("post_id = ?", post.ID).
+			Select("COALESCE(MAX(number), 0)").
+			Scan(&to).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch revisions",
+				"error":   err.Error(),
+			})
+		}
+	}
+	from := c.QueryInt("from", to-1)
+	if from < 0 || to < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "from and to must be revision numbers",
+		})
+	}
+
+	var old, current models.PostRevision
+	if from > 0 {
+		if missing, err := h.findRevision(c, post.ID, from, &old); missing {
+			return err
+		}
+	}
+	if missing, err := h.findRevision(c, post.ID, to, &current); missing {
+		return err
+	}
+
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"title", old.Title, current.Title},
+		{"description", old.Description, current.Description},
+		{"tags", strings.Join(old.Tags, "\n"), strings.Join(current.Tags, "\n")},
+		{"content", old.Content, current.Content},
+	}
+
+	// The revisions are described without their content, which the diff
+	// already covers.
+	var fromView *RevisionView
+	if from > 0 {
+		view := revisionView(old)
+		view.Content = ""
+		fromView = &view
+	}
+	toView := revisionView(current)
+	toView.Content = ""
+	response := fiber.Map{
+		"from": fromView,
+		"to":   toView,
+		"mode": mode,
+	}
+	if mode == "words" {
+		changes := fiber.Map{}
+		for _, field := range fields {
+			if edits := diff.Words(field.before, field.after); diff.Changed(edits) {
+				changes[field.name] = edits
+			}
+		}
+		response["changes"] = changes
+	} else {
+		var unified strings.Builder
+		for _, field := range fields {
+			unified.WriteString(diff.Unified(
+				fmt.Sprintf("revision %d/%s", from, field.name),
+				fmt.Sprintf("revision %d/%s", to, field.name),
+				diff.Lines(field.before, field.after),
+				diffContext,
+			))
+		}
+		response["diff"] = unified.String()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// RestoreRevision puts the text of an old revision back on the post. The
+// old revision stays as it is; the restore is recorded as a new revision.
+func (h *PostHandler) RestoreRevision(c *fiber.Ctx) error {
+	var post models.Post
+	if failed, err := h.postNotEditable(c, &post); failed {
+		return err
+	}
+
+	number, err := c.ParamsInt("number")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid revision number",
+		})
+	}
+
+	var revision models.PostRevision
+	if missing, err := h.findRevision(c, post.ID, number, &revision); missing {
+		return err
+	}
+
+	userID := c.Locals("user_id").(uint)
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPost(tx, &post); err != nil {
+			return err
+		}
+		post.Title = revision.Title
+		post.Description = revision.Description
+		post.Content = revision.Content
+		post.Tags = revision.Tags
+		if err := tx.Model(&post).
+			Select("title", "description", "content", "tags").
+			Updates(&post).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, post, userID, &revision.Number)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to restore revision",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": fmt.Sprintf("Revision %d restored", revision.Number),
+		"post":    post,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errSlugTaken = errors.New("slug is already used by another of your posts")
+
+// postSlugTaken reports whether another live post of the author has slug, now
+// or in its slug history. A slug stays with the post that had it so its old
+// links keep leading there.
+func postSlugTaken(tx *gorm.DB, userID, postID uint, slug string) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.Post{}).
+		Where("user_id = ? AND id <> ? AND slug = ?", userID, postID, slug).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err := tx.Model(&models.PostSlugHistory{}).
+		Joins("JOIN posts ON posts.id = post_slug_histories.post_id").
+		Where("posts.user_id = ? AND posts.id <> ? AND posts.deleted_at IS NULL", userID, postID).
+		Where("post_slug_histories.slug = ?", slug).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// uniquePostSlug finds a slug derived from base that is free for the
+// author's post postID, which is 0 for a new post, by appending a number
+// when needed. Callers hold a lock on the author, see lockAuthor.
+func uniquePostSlug(tx *gorm.DB, userID, postID uint, base string) (string, error) {
+	candidate := base
+	for n := 2; n < 1000; n++ {
+		taken, err := postSlugTaken(tx, userID, postID, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = utils.NumberedSlug(base, n)
+	}
+	return "", errors.New("could not find a free slug")
+}
+
+// lockAuthor locks the author's row for the rest of tx, so that two posts
+// of theirs can't be given the same slug at once.
+func lockAuthor(tx *gorm.DB, userID uint) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+// changePostSlug gives post a new slug, keeping the old one in its history.
+// Taking back one of its own earlier slugs drops that from the history.
+func changePostSlug(tx *gorm.DB, post *models.Post, slug string) error {
+	if err := tx.Where("post_id = ? AND slug = ?", post.ID, slug).
+		Delete(&models.PostSlugHistory{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&models.PostSlugHistory{
+		PostID:    post.ID,
+		Slug:      post.Slug,
+		ChangedAt: time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(post).Update("slug", slug).Error; err != nil {
+		return err
+	}
+	post.Slug = slug
+	return nil
+}
+
+// slugParam reads the :slug parameter, which arrives percent-encoded when
+// the slug isn't ASCII.
+func slugParam(c *fiber.Ctx) string {
+	slug := c.Params("slug")
+	if unescaped, err := url.PathUnescape(slug); err == nil {
+		return unescaped
+	}
+	return slug
+}
+
+// redirectOldSlug answers a request for a slug a post has since changed from
+// with a permanent redirect to its current slug. It reports false when no
+// post the viewer may see used the slug.
+func (h *PostHandler) redirectOldSlug(c *fiber.Ctx, username, slug string) (bool, error) {
+	viewerID := c.Locals("user_id").(uint)
+	var post models.Post
+	err := h.DB.Select("posts.id", "posts.slug").
+		Joins("JOIN users ON users.id = posts.user_id").
+		Joins("JOIN post_slug_histories ON post_slug_histories.post_id = posts.id").
+		Where("users.username = ? AND post_slug_histories.slug = ?", username, slug).
+		Scopes(visiblePosts(viewerID), withoutBlockedUsers("posts.user_id", viewerID)).
+		Order("post_slug_histories.changed_at DESC").
+		First(&post).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve post",
+		})
+	}
+
+	location := routeWithParam(c, "slug", post.Slug)
+	c.Location(location)
+	return true, c.Status(fiber.StatusMovedPermanently).JSON(fiber.Map{
+		"message":  "This post has moved",
+		"slug":     post.Slug,
+		"location": location,
+	})
+}
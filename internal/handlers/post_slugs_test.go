@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// createRenamedPost creates a published post of the user's that used to have
+// the slug from and now has the slug to.
+func createRenamedPost(t *testing.T, db *gorm.DB, userID uint, from, to string) models.Post {
+	t.Helper()
+	post := models.Post{Title: to, Slug: from, UserID: userID, Status: models.PostPublished}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := changePostSlug(db, &post, to); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestUniquePostSlugSkipsSlugHistory(t *testing.T) {
+	db, _, alice := newPostReadTest(t)
+	renamed := createRenamedPost(t, db, alice.ID, "old-name", "new-name")
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+
+	tests := []struct {
+		name           string
+		userID, postID uint
+		base, want     string
+	}{
+		{"current slug", alice.ID, 0, "hello", "hello-2"},
+		{"old slug of another post", alice.ID, 0, "old-name", "old-name-2"},
+		{"own old slug", alice.ID, renamed.ID, "old-name", "old-name"},
+		{"another author's slug", bob.ID, 0, "old-name", "old-name"},
+		{"free slug", alice.ID, 0, "fresh", "fresh"},
+	}
+	for _, tt := range tests {
+		got, err := uniquePostSlug(db, tt.userID, tt.postID, tt.base)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: uniquePostSlug(%q) = %q, want %q", tt.name, tt.base, got, tt.want)
+		}
+	}
+
+	// The old slugs of deleted posts are free again.
+	db.Delete(&renamed)
+	if got, _ := uniquePostSlug(db, alice.ID, 0, "old-name"); got != "old-name" {
+		t.Errorf("old slug of a deleted post: got %q, want old-name", got)
+	}
+}
+
+func TestOldSlugRedirects(t *testing.T) {
+	db, app, alice := newPostReadTest(t)
+	createRenamedPost(t, db, alice.ID, "old-name", "new-name")
+	createRenamedPost(t, db, alice.ID, "古い記事", "新しい記事")
+
+	tests := []struct{ slug, location string }{
+		{"old-name", "/posts/alice/new-name"},
+		{"古い記事", "/posts/alice/" + url.PathEscape("新しい記事")},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/posts/alice/"+url.PathEscape(tt.slug)+"?ref=feed", nil)
+		resp, body := send(t, app, asUser(req, alice.ID))
+		expectStatus(t, resp, body, fiber.StatusMovedPermanently)
+		if got := resp.Header.Get(fiber.HeaderLocation); got != tt.location+"?ref=feed" {
+			t.Errorf("%s redirects to %q, want %q", tt.slug, got, tt.location+"?ref=feed")
+		}
+	}
+
+	resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts/alice/new-name", nil), alice.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+	if body["title"] != "new-name" {
+		t.Fatalf("got %v", body["title"])
+	}
+
+	resp, body = send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts/alice/never-used", nil), alice.ID))
+	expectStatus(t, resp, body, fiber.StatusNotFound)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/relme"
+	"github.com-Personal/go-fiber/internal/utils"
+	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxLocationLength    = 100
+	maxPronounsLength    = 30
+	maxURLLength         = 200
+	maxBioLength         = 2000
+	maxSocialLinks       = 10
+
+	relMeTimeout = 15 * time.Second
+)
+
+// profileFields are the free-form parts of a profile update. Fields left out
+// of the request stay as they are; an empty string clears a field.
+type profileFields struct {
+	DisplayName *string   `json:"display_name"`
+	Bio         *string   `json:"bio"`
+	Location    *string   `json:"location"`
+	Website     *string   `json:"website"`
+	Pronouns    *string   `json:"pronouns"`
+	SocialLinks *[]string `json:"social_links"`
+}
+
+// apply validates the fields and copies them to user and updates. The bio is
+// rich text and is stored sanitized.
+func (f profileFields) apply(user *models.User, updates map[string]interface{}) error {
+	if f.DisplayName != nil {
+		name := strings.TrimSpace(*f.DisplayName)
+		if err := checkPlainText("Display name", name, maxDisplayNameLength); err != nil {
+			return err
+		}
+		updates["display_name"] = name
+		user.DisplayName = name
+	}
+	if f.Location != nil {
+		location := strings.TrimSpace(*f.Location)
+		if err := checkPlainText("Location", location, maxLocationLength); err != nil {
+			return err
+		}
+		updates["location"] = location
+		user.Location = location
+	}
+	if f.Pronouns != nil {
+		pronouns := strings.TrimSpace(*f.Pronouns)
+		if err := checkPlainText("Pronouns", pronouns, maxPronounsLength); err != nil {
+			return err
+		}
+		updates["pronouns"] = pronouns
+		user.Pronouns = pronouns
+	}
+	if f.Website != nil {
+		website := strings.TrimSpace(*f.Website)
+		if website != "" {
+			normalized, err := checkWebURL(website)
+			if err != nil {
+				return fmt.Errorf("Website %v", err)
+			}
+			website = normalized
+		}
+		updates["website"] = website
+		user.Website = website
+	}
+	if f.Bio != nil {
+		bio := utils.SanitizeRichText(*f.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return fmt.Errorf("Bio must be at most %d characters", maxBioLength)
+		}
+		updates["bio"] = bio
+		user.Bio = bio
+	}
+	return nil
+}
+
+// socialLinks validates the requested links, dropping duplicates.
+func (f profileFields) socialLinks() ([]string, error) {
+	if len(*f.SocialLinks) > maxSocialLinks {
+		return nil, fmt.Errorf("At most %d social links are allowed", maxSocialLinks)
+	}
+
+	links := make([]string, 0, len(*f.SocialLinks))
+	seen := map[string]bool{}
+	for _, raw := range *f.SocialLinks {
+		link, err := checkWebURL(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("Social link %q %v", raw, err)
+		}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func checkPlainText(field, value string, maxLength int) error {
+	if utf8.RuneCountInString(value) > maxLength {
+		return fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%s must not contain control characters", field)
+	}
+	return nil
+}
+
+// checkWebURL accepts absolute http and https URLs and returns them in their
+// canonical form.
+func checkWebURL(raw string) (string, error) {
+	if len(raw) > maxURLLength {
+		return "", fmt.Errorf("must be at most %d characters", maxURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("must be an http or https URL")
+	}
+	return u.String(), nil
+}
+
+// replaceSocialLinks makes links the user's list of social links. Links that
+// stay keep their verification.
+func replaceSocialLinks(tx *gorm.DB, userID uint, links []string) error {
+	remove := tx.Where("user_id = ?", userID)
+	if len(links) > 0 {
+		remove = remove.Where("url NOT IN ?", links)
+	}
+	if err := remove.Delete(&models.SocialLink{}).Error; err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if err := tx.Exec(
+			"INSERT INTO social_links (user_id, url, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+			userID, link, time.Now(),
+		).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadSocialLinks(db *gorm.DB, user *models.User) error {
+	return db.Scopes(orderByID).Where("user_id = ?", user.ID).Find(&user.SocialLinks).Error
+}
+
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// profileURL is the address a page has to link to with rel="me" to verify a
+// social link.
+func (h *UserHandler) profileURL(username string) string {
+	return h.BaseURL + "/users/" + url.PathEscape(username)
+}
+
+func (h *UserHandler) UploadCoverImage(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	imageURL, _, err := firebase_utils.UploadFileToFirebaseAndGetURL(c, "cover", "covers")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to upload cover image",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := h.DB.Model(&models.User{}).Where("id = ?", userID).Update("cover_image_url", imageURL).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update cover image URL",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":         "Cover image uploaded successfully",
+		"cover_image_url": imageURL,
+	})
+}
+
+// ProfileHandler verifies social links by fetching the linked pages.
+type ProfileHandler struct {
+	*UserHandler
+	Fetcher relme.Fetcher
+}
+
+func NewProfileHandler(userHandler *UserHandler, fetcher relme.Fetcher) *ProfileHandler {
+	return &ProfileHandler{UserHandler: userHandler, Fetcher: fetcher}
+}
+
+// VerifySocialLink fetches the page behind one of the caller's social links
+// and marks the link verified if the page links back to their profile with
+// rel="me". A link that no longer does loses its verification.
+func (h *ProfileHandler) VerifySocialLink(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var link models.SocialLink
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Social link not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.Select("id", "username").First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), relMeTimeout)
+	defer cancel()
+	verified, err := relme.Verify(ctx, h.Fetcher, link.URL, h.profileURL(user.Username))
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"message": "Failed to fetch the linked page",
+			"error":   err.Error(),
+		})
+	}
+
+	now := time.Now()
+	link.CheckedAt = &now
+	if verified {
+		link.VerifiedAt = &now
+	} else {
+		link.VerifiedAt = nil
+	}
+	if err := h.DB.Model(&link).Select("checked_at", "verified_at").Updates(&link).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save verification",
+			"error":   err.Error(),
+		})
+	}
+
+	if !verified {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "The linked page has no rel=\"me\" link to " + h.profileURL(user.Username),
+			"link":    link,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Social link verified",
+		"link":    link,
+	})
+}
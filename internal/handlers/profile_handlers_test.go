@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// stubFetcher serves fixed pages in place of the web.
+type stubFetcher map[string]string
+
+func (f stubFetcher) Fetch(ctx context.Context, pageURL string) (io.ReadCloser, error) {
+	page, ok := f[pageURL]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return io.NopCloser(strings.NewReader(page)), nil
+}
+
+func newVerifyTest(t *testing.T, fetcher stubFetcher) (*gorm.DB, *fiber.App, models.User) {
+	t.Helper()
+
+	db := newTestDB(t, &models.User{}, &models.SocialLink{})
+	h := NewProfileHandler(newTestUserHandler(t, db), fetcher)
+	app := newTestApp()
+	app.Post("/users/me/social-links/:id/verify", h.VerifySocialLink)
+	return db, app, createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+}
+
+func verifyLink(t *testing.T, app *fiber.App, userID, linkID uint) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/users/me/social-links/"+itoa(linkID)+"/verify", nil)
+	return send(t, app, asUser(req, userID))
+}
+
+func TestVerifySocialLink(t *testing.T) {
+	db, app, alice := newVerifyTest(t, stubFetcher{
+		"https://social.example/@alice": `<a rel="me" href="https://blog.example/users/alice">Blog</a>`,
+	})
+	link := models.SocialLink{UserID: alice.ID, URL: "https://social.example/@alice"}
+	db.Create(&link)
+
+	resp, body := verifyLink(t, app, alice.ID, link.ID)
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	db.First(&link, link.ID)
+	if link.VerifiedAt == nil || link.CheckedAt == nil {
+		t.Fatalf("link not marked verified: %+v", link)
+	}
+}
+
+func TestVerifySocialLinkWithoutBacklink(t *testing.T) {
+	db, app, alice := newVerifyTest(t, stubFetcher{
+		"https://social.example/@alice": `<a rel="me" href="https://blog.example/users/mallory">Blog</a>`,
+	})
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+	link := models.SocialLink{UserID: alice.ID, URL: "https://social.example/@alice", VerifiedAt: &verifiedAt}
+	db.Create(&link)
+
+	resp, body := verifyLink(t, app, alice.ID, link.ID)
+	expectStatus(t, resp, body, fiber.StatusUnprocessableEntity)
+
+	var checked models.SocialLink
+	db.First(&checked, link.ID)
+	if checked.VerifiedAt != nil {
+		t.Fatal("a link that no longer links back kept its verification")
+	}
+	if checked.CheckedAt == nil {
+		t.Fatal("the check was not recorded")
+	}
+}
+
+func TestVerifySocialLinkFetchFailure(t *testing.T) {
+	db, app, alice := newVerifyTest(t, stubFetcher{})
+	link := models.SocialLink{UserID: alice.ID, URL: "https://down.example/alice"}
+	db.Create(&link)
+
+	resp, body := verifyLink(t, app, alice.ID, link.ID)
+	expectStatus(t, resp, body, fiber.StatusBadGateway)
+}
+
+func TestVerifySocialLinkOfAnotherUser(t *testing.T) {
+	db, app, alice := newVerifyTest(t, stubFetcher{
+		"https://social.example/@alice": `<a rel="me" href="https://blog.example/users/alice">Blog</a>`,
+	})
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	link := models.SocialLink{UserID: alice.ID, URL: "https://social.example/@alice"}
+	db.Create(&link)
+
+	resp, body := verifyLink(t, app, bob.ID, link.ID)
+	expectStatus(t, resp, body, fiber.StatusNotFound)
+}
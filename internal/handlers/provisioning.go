@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"gorm.io/gorm"
+)
+
+const maxUsernameLength = 30
+
+// unusablePasswordPrefix marks the password of an account created through an
+// external provider. It can never be a bcrypt hash, so it never matches.
+const unusablePasswordPrefix = "!"
+
+var (
+	errExternalEmailMissing    = errors.New("external account has no email address")
+	errExternalEmailUnverified = errors.New("external account email is not verified")
+)
+
+func hasUsablePassword(user models.User) bool {
+	return !strings.HasPrefix(user.Password, unusablePasswordPrefix)
+}
+
+// usernameBase turns a display name or email into something usable as a
+// username: lowercase letters, digits and underscores only.
+func usernameBase(name, email string) string {
+	source := name
+	if source == "" {
+		source, _, _ = strings.Cut(email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(source) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		case r == ' ' || r == '.' || r == '-':
+			b.WriteRune('_')
+		}
+	}
+
+	base := strings.Trim(b.String(), "_")
+	if len(base) > maxUsernameLength-5 {
+		base = base[:maxUsernameLength-5]
+	}
+	if base == "" {
+		base = "user"
+	}
+	return base
+}
+
+// uniqueUsername finds a free username derived from base by appending a
+// number when needed.
+func uniqueUsername(db *gorm.DB, base string) (string, error) {
+	candidate := base
+	for i := 2; i < 1000; i++ {
+		var count int64
+		if err := db.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			reserved, err := usernameReserved(db, candidate, 0)
+			if err != nil {
+				return "", err
+			}
+			if !reserved {
+				return candidate, nil
+			}
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// provisionExternalUser creates an account for someone who signed in with an
+// external identity provider. The account has no usable password until the
+// user sets one through the password reset flow.
+func provisionExternalUser(db *gorm.DB, name, email string, emailVerified bool) (models.User, error) {
+	username, err := uniqueUsername(db, usernameBase(name, email))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	password, err := utils.GenerateRandomToken()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Username: username,
+		Email:    email,
+		Password: unusablePasswordPrefix + password,
+		Role:     models.RoleAuthor,
+	}
+	if emailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := db.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// externalAccount returns the account registered with a provider-verified
+// email, creating one if there is none. Requiring a verified email stops
+// anyone from taking over an account by signing up with a provider using
+// someone else's address. An account whose email was never verified is
+// claimed rather than linked as is, since whoever registered it may not own
+// the address.
+func externalAccount(db *gorm.DB, name, email string, emailVerified bool) (models.User, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return models.User{}, errExternalEmailMissing
+	}
+	if !emailVerified {
+		return models.User{}, errExternalEmailUnverified
+	}
+
+	var user models.User
+	err := db.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return provisionExternalUser(db, name, email, true)
+	}
+	if err != nil {
+		return user, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return claimUnverifiedAccount(tx, &user)
+		}); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+// claimUnverifiedAccount hands an account registered with an email address
+// nobody proved to own to the person who just proved it. Everything the
+// registrant could sign in with is taken away: the password, two-factor
+// authentication, linked identities, sessions and access tokens.
+func claimUnverifiedAccount(tx *gorm.DB, user *models.User) error {
+	password, err := utils.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"password":          unusablePasswordPrefix + password,
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_step":    0,
+		"firebase_uid":      nil,
+		"email_verified_at": now,
+	}
+	if err := tx.Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if err := revokeAllSessions(tx, user.ID); err != nil {
+		return err
+	}
+
+	user.Password = unusablePasswordPrefix + password
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	user.FirebaseUID = nil
+	user.EmailVerifiedAt = &now
+	return nil
+}
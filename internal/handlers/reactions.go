@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"github.com-Personal/go-fiber/internal/models"
+	"gorm.io/gorm"
+)
+
+var reactionCountColumns = map[string]string{
+	"like":    "likes_count",
+	"dislike": "dislikes_count",
+}
+
+// toggleReaction removes the user's reaction of the same type if there is
+// one, and otherwise replaces any opposite reaction with the new one. The
+// post's counters follow along. It reports whether the reaction was added.
+func toggleReaction(tx *gorm.DB, reaction *models.LikesandDislikes) (bool, error) {
+	removedSame := false
+	for reactionType := range reactionCountColumns {
+		result := tx.Where("user_id = ? AND post_id = ? AND reaction_type = ?", reaction.UserID, reaction.PostID, reactionType).
+			Delete(&models.LikesandDislikes{})
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := adjustReactionCount(tx, reaction.PostID, reactionType, -int(result.RowsAffected)); err != nil {
+			return false, err
+		}
+		if reactionType == reaction.ReactionType {
+			removedSame = true
+		}
+	}
+	if removedSame {
+		return false, nil
+	}
+
+	if err := tx.Create(reaction).Error; err != nil {
+		return false, err
+	}
+	return true, adjustReactionCount(tx, reaction.PostID, reaction.ReactionType, 1)
+}
+
+func adjustReactionCount(tx *gorm.DB, postID uint, reactionType string, delta int) error {
+	column := reactionCountColumns[reactionType]
+	return tx.Model(&models.Post{}).Where("id = ?", postID).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+func adjustCommentsCount(tx *gorm.DB, postID uint, delta int) error {
+	return tx.Model(&models.Post{}).Where("id = ?", postID).
+		UpdateColumn("comments_count", gorm.Expr("comments_count + ?", delta)).Error
+}
+
+// removeAllReactions deletes every reaction a user left, taking them off the
+// counters of the posts they were on.
+func removeAllReactions(tx *gorm.DB, userID uint) error {
+	if err := tx.Exec(`UPDATE posts SET
+		likes_count = likes_count - r.likes,
+		dislikes_count = dislikes_count - r.dislikes
+		FROM (
+			SELECT post_id,
+				COUNT(*) FILTER (WHERE reaction_type = 'like') AS likes,
+				COUNT(*) FILTER (WHERE reaction_type = 'dislike') AS dislikes
+			FROM likesand_dislikes WHERE user_id = ? GROUP BY post_id
+		) AS r
+		WHERE posts.id = r.post_id`, userID).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.LikesandDislikes{}).Error
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = utils.RefreshTokenTTL
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// issueRefreshToken signs a new refresh token and stores its hash in the
+// family of the given session.
+func issueRefreshToken(db *gorm.DB, userID uint, username, sessionID string) (string, error) {
+	refreshToken, err := utils.GenerateToken(userID, username, "", sessionID, utils.RefreshToken, refreshTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	record := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// rotateRefreshToken marks the presented refresh token as used and issues its
+// successor in the same family. Presenting a token that was already rotated
+// revokes the whole session.
+func rotateRefreshToken(db *gorm.DB, refreshToken string, userID uint, username string) (string, error) {
+	var newToken string
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(refreshToken)).
+			First(&stored).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidRefreshToken
+			}
+			return err
+		}
+
+		if stored.UserID != userID || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		if stored.UsedAt != nil {
+			reused = true
+			return revokeSession(tx, stored.FamilyID)
+		}
+
+		now := time.Now()
+		if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		newToken, err = issueRefreshToken(tx, userID, username, stored.FamilyID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if reused {
+		return "", errRefreshTokenReused
+	}
+
+	return newToken, nil
+}
+
+// revokeRefreshToken revokes the session the presented refresh token belongs
+// to. Unknown tokens are ignored.
+func revokeRefreshToken(db *gorm.DB, refreshToken string) error {
+	var stored models.RefreshToken
+	err := db.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&stored).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return revokeSession(db, stored.FamilyID)
+}
+
+func setRefreshTokenCookie(c *fiber.Ctx, refreshToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Expires:  time.Now().Add(refreshTokenTTL),
+		Secure:   false,
+		Path:     "/",
+		HTTPOnly: true,
+		SameSite: "Strict",
+		Domain:   "localhost",
+	})
+}
+
+func clearRefreshTokenCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		Secure:   false,
+		Path:     "/",
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+}
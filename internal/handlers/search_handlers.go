@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com-Personal/go-fiber/internal/database"
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Highlighted words are wrapped in these markers by ts_headline and turned
+// into <mark> once the rest of the text has been escaped.
+const (
+	highlightStart = "⟦"
+	highlightStop  = "⟧"
+)
+
+var (
+	titleHeadlineOptions   = "HighlightAll=true, StartSel=" + highlightStart + ", StopSel=" + highlightStop
+	snippetHeadlineOptions = "MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \", " +
+		"StartSel=" + highlightStart + ", StopSel=" + highlightStop
+)
+
+var prefixTerm = regexp.MustCompile(`^[\pL\pN_]+\*$`)
+
+// SearchResult is a post summary with its rank and highlighted text.
+type SearchResult struct {
+	PostSummary
+	Rank           float32 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+type searchCursor struct {
+	Rank float32 `json:"r"`
+	ID   uint    `json:"id"`
+}
+
+type searchHit struct {
+	ID             uint
+	Rank           float32
+	TitleHighlight string
+	Snippet        string
+}
+
+// splitSearchQuery takes prefix terms such as postgr* out of a query and
+// leaves the rest, with its quoted phrases, "or" and -exclusions, to
+// websearch_to_tsquery. A term ending in * inside quotes stays part of the
+// phrase.
+func splitSearchQuery(q string) (string, []string) {
+	var rest []string
+	var prefixes []string
+	inQuote := false
+	for _, field := range strings.Fields(q) {
+		if !inQuote && prefixTerm.MatchString(field) {
+			prefixes = append(prefixes, strings.TrimSuffix(field, "*"))
+		} else {
+			rest = append(rest, field)
+		}
+		if strings.Count(field, `"`)%2 == 1 {
+			inQuote = !inQuote
+		}
+	}
+	return strings.Join(rest, " "), prefixes
+}
+
+// searchQuery builds the tsquery for q. It reports false when q has nothing
+// to search for.
+func searchQuery(q string) (clause.Expr, bool) {
+	rest, prefixes := splitSearchQuery(q)
+
+	var parts []string
+	var args []interface{}
+	if rest != "" {
+		parts = append(parts, "websearch_to_tsquery(?::regconfig, ?)")
+		args = append(args, database.SearchConfig, rest)
+	}
+	if len(prefixes) > 0 {
+		terms := make([]string, len(prefixes))
+		for i, prefix := range prefixes {
+			terms[i] = prefix + ":*"
+		}
+		parts = append(parts, "to_tsquery(?::regconfig, ?)")
+		args = append(args, database.SearchConfig, strings.Join(terms, " & "))
+	}
+	if len(parts) == 0 {
+		return clause.Expr{}, false
+	}
+	return gorm.Expr("("+strings.Join(parts, " && ")+")", args...), true
+}
+
+// highlight escapes text from ts_headline and marks the matched words.
+func highlight(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	return strings.ReplaceAll(text, highlightStop, "</mark>")
+}
+
+// Search ranks the posts the viewer may see against q, supporting "quoted
+// phrases", prefix* terms, or and -exclusions, and takes the same filters
+// as GetPosts.
+func (h *PostHandler) Search(c *fiber.Ctx) error {
+	viewerID := c.Locals("user_id").(uint)
+
+	query, ok := searchQuery(c.Query("q"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Search query is required",
+		})
+	}
+
+	filters, err := postFilters(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid filter",
+			"error":   err.Error(),
+		})
+	}
+
+	var cursor searchCursor
+	hasCursor, err := decodeCursor(c, &cursor)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid cursor",
+		})
+	}
+
+	limit := pageSize(c)
+	matches := h.DB.Model(&models.Post{}).
+		Select("posts.id, posts.title, posts.content, ts_rank(posts.search_vector, ?) AS rank", query).
+		Scopes(listedPosts(viewerID), filters).
+		Where("posts.search_vector @@ ?", query)
+	if hasCursor {
+		matches = matches.Where("(ts_rank(posts.search_vector, ?), posts.id) < (?, ?)", query, cursor.Rank, cursor.ID)
+	}
+	matches = matches.Order("rank DESC").Order("posts.id DESC").Limit(limit + 1)
+
+	// Headlines are expensive, so they are only made for the page.
+	var hits []searchHit
+	err = h.DB.Table("(?) AS hits", matches).
+		Select(
+			"hits.id, hits.rank, "+
+				"ts_headline(?::regconfig, hits.title, ?, ?) AS title_highlight, "+
+				"ts_headline(?::regconfig, hits.content, ?, ?) AS snippet",
+			database.SearchConfig, query, titleHeadlineOptions,
+			database.SearchConfig, query, snippetHeadlineOptions,
+		).
+		Order("hits.rank DESC").
+		Order("hits.id DESC").
+		Scan(&hits).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to search posts",
+			"error":   err.Error(),
+		})
+	}
+
+	var nextCursor *string
+	if len(hits) > limit {
+		hits = hits[:limit]
+		last := hits[limit-1]
+		encoded := encodeCursor(searchCursor{Rank: last.Rank, ID: last.ID})
+		nextCursor = &encoded
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var posts []models.Post
+	if len(ids) > 0 {
+		if err := h.DB.Preload("User", withDeletedUsers).Where("id IN ?", ids).Find(&posts).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch posts",
+				"error":   err.Error(),
+			})
+		}
+	}
+	byID := make(map[uint]models.Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		post, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			PostSummary:    summarizePost(post),
+			Rank:           hit.Rank,
+			TitleHighlight: highlight(hit.TitleHighlight),
+			Snippet:        highlight(hit.Snippet),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"results":     results,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// User agent fragments and their readable names, checked in order. Order matters:
+// Edge and Opera also claim to be Chrome, and Chrome claims to be Safari.
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeDevice turns a user agent into something like "Firefox on Linux".
+func describeDevice(userAgent string) string {
+	browser := ""
+	for _, name := range userAgentBrowsers {
+		if strings.Contains(userAgent, name[0]) {
+			browser = name[1]
+			break
+		}
+	}
+	system := ""
+	for _, name := range userAgentSystems {
+		if strings.Contains(userAgent, name[0]) {
+			system = name[1]
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+// startSession records a new session for the device making the request and
+// issues its first access and refresh tokens.
+func startSession(db *gorm.DB, c *fiber.Ctx, user models.User) (string, string, error) {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		Device:     describeDevice(userAgent),
+		UserAgent:  userAgent,
+		IP:         c.IP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateToken(user.ID, user.Username, user.Role, session.ID, utils.AccessToken, accessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := issueRefreshToken(db, user.ID, user.Username, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// touchSession extends a session after its refresh token was rotated.
+func touchSession(db *gorm.DB, c *fiber.Ctx, sessionID string) error {
+	now := time.Now()
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"expires_at":   now.Add(refreshTokenTTL),
+			"ip":           c.IP(),
+		}).Error
+}
+
+// revokeSession ends a session: its refresh tokens stop working and
+// AuthMiddleware rejects its access tokens.
+func revokeSession(db *gorm.DB, sessionID string) error {
+	now := time.Now()
+	if err := db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
+
+// revokeAllSessions ends every session of a user.
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	return revokeOtherSessions(db, userID, "")
+}
+
+// revokeOtherSessions ends every session of a user except keepID. An empty
+// keepID, as for requests made with a personal access token, ends them all.
+func revokeOtherSessions(db *gorm.DB, userID uint, keepID string) error {
+	now := time.Now()
+	sessions := db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	refreshTokens := db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepID != "" {
+		sessions = sessions.Where("id <> ?", keepID)
+		refreshTokens = refreshTokens.Where("family_id <> ?", keepID)
+	}
+
+	if err := sessions.Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return refreshTokens.Update("revoked_at", now).Error
+}
+
+func (h *UserHandler) GetSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	currentID, _ := c.Locals("session_id").(string)
+
+	var sessions []models.Session
+	err := h.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch sessions",
+			"error":   err.Error(),
+		})
+	}
+
+	type sessionResponse struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{Session: session, Current: session.ID == currentID}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sessions": response,
+	})
+}
+
+func (h *UserHandler) RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var session models.Session
+	err := h.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), userID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Session not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSession(tx, session.ID)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to revoke session",
+			"error":   err.Error(),
+		})
+	}
+
+	if currentID, _ := c.Locals("session_id").(string); currentID == session.ID {
+		clearRefreshTokenCookie(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeAllSessions logs the user out everywhere, including the session
+// making the request.
+func (h *UserHandler) RevokeAllSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeAllSessions(tx, userID)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to revoke sessions",
+			"error":   err.Error(),
+		})
+	}
+
+	clearRefreshTokenCookie(c)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Logged out of all sessions",
+	})
+}
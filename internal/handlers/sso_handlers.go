@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/sso"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const oauthStateTTL = 10 * time.Minute
+
+// ssoBindingCookie ties an authorization request to the browser that
+// started it, so that a callback URL with someone else's state can't log
+// the victim into the attacker's account or link the attacker's identity
+// to the victim's.
+const ssoBindingCookie = "sso_binding"
+
+var errProviderAlreadyLinked = errors.New("account already has an identity for this provider")
+
+// SSOHandler signs users in with external OpenID Connect providers and lets
+// them link and unlink those identities.
+type SSOHandler struct {
+	*UserHandler
+	Providers map[string]*sso.Provider
+}
+
+func NewSSOHandler(users *UserHandler, providers []*sso.Provider) *SSOHandler {
+	byName := make(map[string]*sso.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Name] = p
+	}
+	return &SSOHandler{UserHandler: users, Providers: byName}
+}
+
+func (h *SSOHandler) provider(c *fiber.Ctx) (*sso.Provider, error) {
+	p, ok := h.Providers[c.Params("provider")]
+	if !ok {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Unknown login provider",
+		})
+	}
+	return p, nil
+}
+
+func (h *SSOHandler) redirectURL(p *sso.Provider) string {
+	return h.BaseURL + "/auth/" + p.Name + "/callback"
+}
+
+// setBindingCookie sends the browser the binding of an authorization
+// request. It is only sent back to the callback, which the provider reaches
+// with a top-level redirect, hence SameSite Lax rather than Strict.
+func (h *SSOHandler) setBindingCookie(c *fiber.Ctx, p *sso.Provider, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     ssoBindingCookie,
+		Value:    value,
+		Expires:  expires,
+		Secure:   strings.HasPrefix(h.BaseURL, "https://"),
+		Path:     "/auth/" + p.Name + "/callback",
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+}
+
+// startAuthorization stores the state, nonce and PKCE verifier of a new
+// authorization request, binds it to the browser with a cookie and returns
+// the provider URL to send the user to.
+func (h *SSOHandler) startAuthorization(c *fiber.Ctx, p *sso.Provider, userID *uint) (string, error) {
+	var values [4]string
+	for i := range values {
+		value, err := utils.GenerateRandomToken()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier, binding := values[0], values[1], values[2], values[3]
+
+	now := time.Now()
+	if err := h.DB.Where("expires_at < ?", now).Delete(&models.OAuthState{}).Error; err != nil {
+		return "", err
+	}
+	if err := h.DB.Create(&models.OAuthState{
+		StateHash:    utils.HashToken(state),
+		BindingHash:  utils.HashToken(binding),
+		Provider:     p.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		UserID:       userID,
+		ExpiresAt:    now.Add(oauthStateTTL),
+	}).Error; err != nil {
+		return "", err
+	}
+	h.setBindingCookie(c, p, binding, now.Add(oauthStateTTL))
+
+	return p.AuthCodeURL(h.redirectURL(p), state, nonce, verifier), nil
+}
+
+func (h *SSOHandler) GetProviders(c *fiber.Ctx) error {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"providers": names,
+	})
+}
+
+// Login redirects the browser to the provider's authorization page.
+func (h *SSOHandler) Login(c *fiber.Ctx) error {
+	p, err := h.provider(c)
+	if p == nil {
+		return err
+	}
+
+	url, err := h.startAuthorization(c, p, nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to start login",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Redirect(url, fiber.StatusFound)
+}
+
+// Link returns the authorization URL the logged in user must visit to link an
+// identity at the provider to their account. It has to be called from the
+// browser that will visit the URL, which receives the binding cookie.
+func (h *SSOHandler) Link(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	p, err := h.provider(c)
+	if p == nil {
+		return err
+	}
+
+	url, err := h.startAuthorization(c, p, &userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to start linking",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"authorization_url": url,
+	})
+}
+
+// Callback completes both logins and identity linking once the provider
+// redirects back with an authorization code.
+func (h *SSOHandler) Callback(c *fiber.Ctx) error {
+	p, err := h.provider(c)
+	if p == nil {
+		return err
+	}
+
+	binding := c.Cookies(ssoBindingCookie)
+	h.setBindingCookie(c, p, "", time.Now().Add(-time.Hour))
+
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Authorization was not granted",
+			"error":   reason,
+		})
+	}
+
+	if binding == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid or expired login request",
+		})
+	}
+
+	var state models.OAuthState
+	result := h.DB.Clauses(clause.Returning{}).
+		Where("state_hash = ? AND binding_hash = ? AND provider = ?",
+			utils.HashToken(c.Query("state")), utils.HashToken(binding), p.Name).
+		Delete(&state)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   result.Error.Error(),
+		})
+	}
+	if result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid or expired login request",
+		})
+	}
+
+	identity, err := p.Exchange(c.UserContext(), h.redirectURL(p), c.Query("code"), state.Nonce, state.CodeVerifier)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Failed to verify the login with " + p.Name,
+			"error":   err.Error(),
+		})
+	}
+
+	if state.UserID != nil {
+		return h.linkIdentity(c, p.Name, *state.UserID, identity)
+	}
+	return h.loginWithIdentity(c, p.Name, identity)
+}
+
+func (h *SSOHandler) loginWithIdentity(c *fiber.Ctx, provider string, identity *sso.Identity) error {
+	var user models.User
+	var linked models.UserIdentity
+	err := h.DB.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&linked).Error
+	switch {
+	case err == nil:
+		err = h.DB.First(&user, linked.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Account not found",
+			})
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = externalAccount(h.DB, identity.Name, identity.Email, identity.EmailVerified)
+		switch {
+		case errors.Is(err, errExternalEmailMissing):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "The " + provider + " account has no email address",
+			})
+		case errors.Is(err, errExternalEmailUnverified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Verify your email with " + provider + " before signing in",
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to find or create account",
+				"error":   err.Error(),
+			})
+		}
+
+		_, err = h.attachIdentity(c, user.ID, provider, identity)
+		if errors.Is(err, errProviderAlreadyLinked) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "This account is already linked to another " + provider + " user",
+			})
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if throttled, err := h.loginThrottled(c, user.Email); throttled {
+		return err
+	}
+
+	return h.beginLogin(c, user)
+}
+
+func (h *SSOHandler) linkIdentity(c *fiber.Ctx, provider string, userID uint, identity *sso.Identity) error {
+	var existing models.UserIdentity
+	err := h.DB.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "This " + provider + " account is linked to another user",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":  "Identity already linked",
+			"identity": existing,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	linked, err := h.attachIdentity(c, userID, provider, identity)
+	if errors.Is(err, errProviderAlreadyLinked) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Unlink your current " + provider + " identity first",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to link identity",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Identity linked successfully",
+		"identity": linked,
+	})
+}
+
+func (h *SSOHandler) attachIdentity(c *fiber.Ctx, userID uint, provider string, identity *sso.Identity) (models.UserIdentity, error) {
+	linked := models.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, provider).Count(&count).Error; err != nil {
+		return linked, err
+	}
+	if count > 0 {
+		return linked, errProviderAlreadyLinked
+	}
+
+	if err := h.DB.Create(&linked).Error; err != nil {
+		return linked, err
+	}
+
+	recordAudit(h.DB, &userID, models.AuditIdentityLinked, c.IP(), provider)
+	return linked, nil
+}
+
+func (h *SSOHandler) GetIdentities(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var identities []models.UserIdentity
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch identities",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"identities": identities,
+	})
+}
+
+// Unlink removes a linked identity, as long as the user keeps another way to
+// sign in.
+func (h *SSOHandler) Unlink(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var identity models.UserIdentity
+	if err := h.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Identity not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	var others int64
+	if err := h.DB.Model(&models.UserIdentity{}).Where("user_id = ? AND id <> ?", userID, identity.ID).Count(&others).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+	if others == 0 && user.FirebaseUID == nil && !hasUsablePassword(user) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Set a password before unlinking your last sign-in method",
+		})
+	}
+
+	if err := h.DB.Delete(&identity).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to unlink identity",
+			"error":   err.Error(),
+		})
+	}
+	recordAudit(h.DB, &userID, models.AuditIdentityUnlinked, c.IP(), identity.Provider)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Identity unlinked successfully",
+	})
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/sso"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const fakeClientID = "blog-client"
+
+// fakeIssuer is an OpenID Connect provider that hands out codes for whatever
+// identity a test asks for, and redeems them like a real one would: once,
+// with the PKCE verifier matching the challenge it was issued for.
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	issuer := &fakeIssuer{key: key, codes: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/authorize",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorize plays the user approving the authorization request at
+// authURL, returning the code the provider would redirect back with.
+func (f *fakeIssuer) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, f.URL+"/authorize") {
+		t.Fatalf("unexpected authorization URL %q", authURL)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != fakeClientID {
+		t.Fatalf("authorization request without PKCE or client: %s", authURL)
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("generating code: %v", err)
+	}
+	code = base64.RawURLEncoding.EncodeToString(random)
+	f.mu.Lock()
+	f.codes[code] = fakeGrant{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	f.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	f.mu.Lock()
+	grant, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   f.URL,
+		"aud":   fakeClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(f.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+type ssoTest struct {
+	db     *gorm.DB
+	app    *fiber.App
+	issuer *fakeIssuer
+}
+
+func newSSOTest(t *testing.T) *ssoTest {
+	t.Helper()
+
+	db := newTestDB(t, &models.User{}, &models.UserIdentity{}, &models.OAuthState{},
+		&models.Session{}, &models.RefreshToken{}, &models.AuditLog{}, &models.UsernameHistory{},
+		&models.PersonalAccessToken{}, &models.RecoveryCode{})
+	issuer := newFakeIssuer(t)
+	provider, err := sso.NewProvider(context.Background(), sso.Config{
+		Name:         "fake",
+		Issuer:       issuer.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	h := NewSSOHandler(newTestUserHandler(t, db), []*sso.Provider{provider})
+	app := newTestApp()
+	app.Get("/auth/:provider", h.Login)
+	app.Get("/auth/:provider/callback", h.Callback)
+	app.Post("/users/me/identities/:provider", h.Link)
+	app.Delete("/users/me/identities/:id", h.Unlink)
+
+	return &ssoTest{db: db, app: app, issuer: issuer}
+}
+
+// login starts a login and returns the provider URL it redirects to and the
+// binding cookie it sets.
+func (s *ssoTest) login(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+
+	resp, body := send(t, s.app, httptest.NewRequest(http.MethodGet, "/auth/fake", nil))
+	expectStatus(t, resp, body, fiber.StatusFound)
+	return resp.Header.Get(fiber.HeaderLocation), bindingCookie(t, resp)
+}
+
+func bindingCookie(t *testing.T, resp *http.Response) *http.Cookie {
+	t.Helper()
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == ssoBindingCookie {
+			if !cookie.HttpOnly || cookie.Path != "/auth/fake/callback" {
+				t.Fatalf("binding cookie %v should be HttpOnly and limited to the callback", cookie)
+			}
+			return cookie
+		}
+	}
+	t.Fatal("no binding cookie was set")
+	return nil
+}
+
+func (s *ssoTest) callback(t *testing.T, state, code string, cookie *http.Cookie) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return send(t, s.app, req)
+}
+
+func aliceClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":            "alice-at-provider",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice Doe",
+	}
+}
+
+func TestSSOLoginProvisionsAccount(t *testing.T) {
+	s := newSSOTest(t)
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusOK)
+	if body["access_token"] == "" || body["access_token"] == nil {
+		t.Fatalf("no access token in %v", body)
+	}
+
+	var user models.User
+	if err := s.db.Where("email = ?", "alice@example.com").First(&user).Error; err != nil {
+		t.Fatalf("account was not created: %v", err)
+	}
+	if user.Username != "alice_doe" || user.EmailVerifiedAt == nil || hasUsablePassword(user) {
+		t.Fatalf("unexpected account %+v", user)
+	}
+	var identity models.UserIdentity
+	if err := s.db.Where("provider = ? AND subject = ?", "fake", "alice-at-provider").First(&identity).Error; err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity not linked to the new account: %+v, %v", identity, err)
+	}
+
+	// The state is used up.
+	resp, body = s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+}
+
+func TestSSOLoginUsesLinkedIdentity(t *testing.T) {
+	s := newSSOTest(t)
+	user := createTestUser(t, s.db, models.User{Username: "alice", Email: "old@example.com"})
+	s.db.Create(&models.UserIdentity{UserID: user.ID, Provider: "fake", Subject: "alice-at-provider"})
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	self, _ := body["user"].(map[string]interface{})
+	if self["username"] != "alice" {
+		t.Fatalf("logged in as %v, want alice", self["username"])
+	}
+	var count int64
+	s.db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d users, want no new account", count)
+	}
+}
+
+func TestSSOLoginClaimsUnverifiedAccount(t *testing.T) {
+	s := newSSOTest(t)
+	squatted := createSquattedAccount(t, s.db, "alice", "alice@example.com")
+	s.db.Create(&models.UserIdentity{UserID: squatted.ID, Provider: "other", Subject: "squatter"})
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	expectClaimed(t, s.db, squatted.ID)
+	var identities []models.UserIdentity
+	s.db.Where("user_id = ?", squatted.ID).Find(&identities)
+	if len(identities) != 1 || identities[0].Subject != "alice-at-provider" {
+		t.Fatalf("identities = %+v, want only the one just signed in with", identities)
+	}
+}
+
+func TestSSOCallbackRejectsBadState(t *testing.T) {
+	s := newSSOTest(t)
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	_, otherCookie := s.login(t)
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie *http.Cookie
+	}{
+		{"unknown state", "not-a-state", cookie},
+		{"no binding cookie", state, nil},
+		{"cookie of another request", state, otherCookie},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := s.callback(t, tt.state, code, tt.cookie)
+			expectStatus(t, resp, body, fiber.StatusBadRequest)
+		})
+	}
+
+	var count int64
+	s.db.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d accounts created by rejected callbacks", count)
+	}
+
+	// None of the rejected callbacks used up the real one.
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusOK)
+}
+
+func TestSSOCallbackRejectsExpiredState(t *testing.T) {
+	s := newSSOTest(t)
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	s.db.Model(&models.OAuthState{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+}
+
+func TestSSOCallbackRejectsPKCEMismatch(t *testing.T) {
+	s := newSSOTest(t)
+
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	s.db.Model(&models.OAuthState{}).Where("1 = 1").Update("code_verifier", "some-other-verifier")
+
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusUnauthorized)
+}
+
+func TestSSOCallbackRejectsUnverifiedEmail(t *testing.T) {
+	s := newSSOTest(t)
+	createTestUser(t, s.db, models.User{Username: "alice", Email: "alice@example.com"})
+
+	claims := aliceClaims()
+	claims["email_verified"] = false
+	authURL, cookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, claims)
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusForbidden)
+}
+
+// link starts linking for userID and returns the authorization URL and the
+// binding cookie.
+func (s *ssoTest) link(t *testing.T, userID uint) (string, *http.Cookie) {
+	t.Helper()
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/users/me/identities/fake", nil), userID)
+	resp, body := send(t, s.app, req)
+	expectStatus(t, resp, body, fiber.StatusOK)
+	authURL, _ := body["authorization_url"].(string)
+	return authURL, bindingCookie(t, resp)
+}
+
+func TestSSOLink(t *testing.T) {
+	s := newSSOTest(t)
+	user := createTestUser(t, s.db, models.User{Username: "bob", Email: "bob@example.com"})
+
+	authURL, cookie := s.link(t, user.ID)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusCreated)
+
+	var identity models.UserIdentity
+	if err := s.db.Where("provider = ? AND subject = ?", "fake", "alice-at-provider").First(&identity).Error; err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity not linked to bob: %+v, %v", identity, err)
+	}
+}
+
+func TestSSOLinkRejectsIdentityOfAnotherUser(t *testing.T) {
+	s := newSSOTest(t)
+	alice := createTestUser(t, s.db, models.User{Username: "alice", Email: "alice@example.com"})
+	bob := createTestUser(t, s.db, models.User{Username: "bob", Email: "bob@example.com"})
+	s.db.Create(&models.UserIdentity{UserID: alice.ID, Provider: "fake", Subject: "alice-at-provider"})
+
+	authURL, cookie := s.link(t, bob.ID)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, cookie)
+	expectStatus(t, resp, body, fiber.StatusConflict)
+}
+
+// A link request started by an attacker can't be completed in the victim's
+// browser, which doesn't hold the attacker's binding cookie.
+func TestSSOLinkRequiresTheStartingBrowser(t *testing.T) {
+	s := newSSOTest(t)
+	attacker := createTestUser(t, s.db, models.User{Username: "mallory", Email: "mallory@example.com"})
+
+	authURL, _ := s.link(t, attacker.ID)
+	_, victimCookie := s.login(t)
+	state, code := s.issuer.authorize(t, authURL, aliceClaims())
+	resp, body := s.callback(t, state, code, victimCookie)
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+
+	var count int64
+	s.db.Model(&models.UserIdentity{}).Count(&count)
+	if count != 0 {
+		t.Fatal("the identity was linked")
+	}
+}
+
+func TestSSOUnlink(t *testing.T) {
+	s := newSSOTest(t)
+	user := createTestUser(t, s.db, models.User{Username: "bob", Email: "bob@example.com"})
+	identity := models.UserIdentity{UserID: user.ID, Provider: "fake", Subject: "bob-at-provider"}
+	s.db.Create(&identity)
+
+	other := createTestUser(t, s.db, models.User{Username: "carol", Email: "carol@example.com"})
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/users/me/identities/"+itoa(identity.ID), nil), other.ID)
+	resp, body := send(t, s.app, req)
+	expectStatus(t, resp, body, fiber.StatusNotFound)
+
+	req = asUser(httptest.NewRequest(http.MethodDelete, "/users/me/identities/"+itoa(identity.ID), nil), user.ID)
+	resp, body = send(t, s.app, req)
+	expectStatus(t, resp, body, fiber.StatusOK)
+	if err := s.db.First(&models.UserIdentity{}, identity.ID).Error; err == nil {
+		t.Fatal("identity still linked")
+	}
+}
+
+func TestSSOUnlinkKeepsLastSignInMethod(t *testing.T) {
+	s := newSSOTest(t)
+	user := createTestUser(t, s.db, models.User{
+		Username: "dave",
+		Email:    "dave@example.com",
+		Password: unusablePasswordPrefix + "random",
+	})
+	identity := models.UserIdentity{UserID: user.ID, Provider: "fake", Subject: "dave-at-provider"}
+	s.db.Create(&identity)
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/users/me/identities/"+itoa(identity.ID), nil), user.ID)
+	resp, body := send(t, s.app, req)
+	expectStatus(t, resp, body, fiber.StatusBadRequest)
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+func totpIssuer() string {
+	if issuer := utils.GetSecretOrEnv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "go-fiber-blog"
+}
+
+// checkTOTP validates a code and records the matched time step so the same
+// code can't be replayed, even by two concurrent requests.
+func checkTOTP(db *gorm.DB, user *models.User, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false, nil
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+func useRecoveryCode(db *gorm.DB, userID uint, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+func checkSecondFactor(db *gorm.DB, user *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return checkTOTP(db, user, code)
+	}
+	if recoveryCode != "" {
+		return useRecoveryCode(db, user.ID, recoveryCode)
+	}
+	return false, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (h *UserHandler) EnrollTOTP(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Two-factor authentication is already enabled",
+		})
+	}
+
+	// A stolen access token alone mustn't be enough to attach someone else's
+	// authenticator to the account.
+	if hasUsablePassword(user) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid password",
+			})
+		}
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to generate secret",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save secret",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":     "Scan the provisioning URI with your authenticator app and confirm with a code",
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(totpIssuer(), user.Email, secret),
+	})
+}
+
+func (h *UserHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Two-factor authentication is already enabled",
+		})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Start enrollment before confirming a code",
+		})
+	}
+
+	ok, err := checkTOTP(h.DB, &user, data.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to verify code",
+			"error":   err.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid code",
+		})
+	}
+
+	var codes []string
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to enable two-factor authentication",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe, they will not be shown again",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *UserHandler) DisableTOTP(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var data struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Two-factor authentication is not enabled",
+		})
+	}
+
+	// Accounts created through a login provider have no password to check;
+	// the TOTP or recovery code is what proves it's them.
+	if hasUsablePassword(user) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid password",
+			})
+		}
+	}
+
+	ok, err := checkSecondFactor(h.DB, &user, data.Code, data.RecoveryCode)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to verify code",
+			"error":   err.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid code",
+		})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to disable two-factor authentication",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// VerifyLoginMFA exchanges the challenge token returned by Login plus a TOTP
+// or recovery code for access and refresh tokens.
+func (h *UserHandler) VerifyLoginMFA(c *fiber.Ctx) error {
+	var data struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Unable to parse request body",
+			"error":   err.Error(),
+		})
+	}
+
+	claims, err := utils.ValidateToken(data.MFAToken, utils.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid or expired MFA challenge",
+		})
+	}
+
+	// Each challenge allows a single attempt; after a wrong code the user has
+	// to log in again rather than keep guessing with the same challenge.
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := consumeUserToken(tx, data.MFAToken, models.MFAChallengeToken)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidUserToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid or expired MFA challenge",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid or expired MFA challenge",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Two-factor authentication is not enabled",
+		})
+	}
+
+	if throttled, err := h.loginThrottled(c, user.Email); throttled {
+		return err
+	}
+
+	ok, err := checkSecondFactor(h.DB, &user, data.Code, data.RecoveryCode)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to verify code",
+			"error":   err.Error(),
+		})
+	}
+	if !ok {
+		h.recordLoginFailure(c, user.Email, &user)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid code",
+		})
+	}
+
+	return h.completeLogin(c, user)
+}
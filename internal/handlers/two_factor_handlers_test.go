@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDisableTOTP(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		body     string
+		status   int
+	}{
+		{"provider account with recovery code", unusablePasswordPrefix + "random", `{"recovery_code":"abcd-efgh"}`, fiber.StatusOK},
+		{"provider account with wrong code", unusablePasswordPrefix + "random", `{"recovery_code":"wrong"}`, fiber.StatusUnauthorized},
+		{"password account with password and code", string(hash), `{"password":"correct horse","recovery_code":"abcd-efgh"}`, fiber.StatusOK},
+		{"password account without password", string(hash), `{"recovery_code":"abcd-efgh"}`, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &models.User{}, &models.RecoveryCode{})
+			h := newTestUserHandler(t, db)
+			app := newTestApp()
+			app.Delete("/users/me/2fa", h.DisableTOTP)
+
+			enabledAt := time.Now()
+			user := createTestUser(t, db, models.User{
+				Username:      "alice",
+				Email:         "alice@example.com",
+				Password:      tt.password,
+				TOTPSecret:    "JBSWY3DPEHPK3PXP",
+				TOTPEnabledAt: &enabledAt,
+			})
+			db.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken("abcd-efgh")})
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/me/2fa", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, body := send(t, app, asUser(req, user.ID))
+			expectStatus(t, resp, body, tt.status)
+
+			var after models.User
+			db.First(&after, user.ID)
+			if disabled := after.TOTPEnabledAt == nil; disabled != (tt.status == fiber.StatusOK) {
+				t.Fatalf("two-factor disabled = %v after status %d", disabled, tt.status)
+			}
+		})
+	}
+}
+
+func TestEnrollTOTPRequiresPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		body     string
+		status   int
+	}{
+		{"provider account", unusablePasswordPrefix + "random", `{}`, fiber.StatusOK},
+		{"password account with password", string(hash), `{"password":"correct horse"}`, fiber.StatusOK},
+		{"password account with wrong password", string(hash), `{"password":"wrong"}`, fiber.StatusUnauthorized},
+		{"password account without password", string(hash), `{}`, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &models.User{})
+			h := newTestUserHandler(t, db)
+			app := newTestApp()
+			app.Post("/users/me/2fa/enroll", h.EnrollTOTP)
+
+			user := createTestUser(t, db, models.User{
+				Username: "alice",
+				Email:    "alice@example.com",
+				Password: tt.password,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/users/me/2fa/enroll", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, body := send(t, app, asUser(req, user.ID))
+			expectStatus(t, resp, body, tt.status)
+
+			var after models.User
+			db.First(&after, user.ID)
+			if enrolled := after.TOTPSecret != ""; enrolled != (tt.status == fiber.StatusOK) {
+				t.Fatalf("secret saved = %v after status %d", enrolled, tt.status)
+			}
+		})
+	}
+}
+
+func TestLoginMFAChallengeIsSingleUse(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newTestDB(t, &models.User{}, &models.UserToken{}, &models.RecoveryCode{}, &models.Session{}, &models.RefreshToken{})
+	h := newTestUserHandler(t, db)
+	app := newTestApp()
+	app.Post("/login", h.Login)
+	app.Post("/login/mfa", h.VerifyLoginMFA)
+
+	enabledAt := time.Now()
+	user := createTestUser(t, db, models.User{
+		Username:      "alice",
+		Email:         "alice@example.com",
+		Password:      string(hash),
+		TOTPSecret:    "JBSWY3DPEHPK3PXP",
+		TOTPEnabledAt: &enabledAt,
+	})
+	for _, code := range []string{"aaaa-aaaa", "bbbb-bbbb", "cccc-cccc"} {
+		db.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(code)})
+	}
+
+	post := func(target, body string) (*http.Response, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return send(t, app, req)
+	}
+	login := func() string {
+		resp, body := post("/login", `{"email":"alice@example.com","password":"correct horse"}`)
+		expectStatus(t, resp, body, fiber.StatusOK)
+		token, _ := body["mfa_token"].(string)
+		if token == "" {
+			t.Fatalf("login returned no MFA challenge: %v", body)
+		}
+		return token
+	}
+	verify := func(token, code string) int {
+		resp, _ := post("/login/mfa", `{"mfa_token":"`+token+`","recovery_code":"`+code+`"}`)
+		return resp.StatusCode
+	}
+
+	challenge := login()
+	if status := verify(challenge, "aaaa-aaaa"); status != fiber.StatusOK {
+		t.Fatalf("first use of challenge: status %d, want 200", status)
+	}
+	if status := verify(challenge, "bbbb-bbbb"); status != fiber.StatusUnauthorized {
+		t.Fatalf("reused challenge: status %d, want 401", status)
+	}
+
+	// A wrong code uses the challenge up too.
+	challenge = login()
+	if status := verify(challenge, "wrong"); status != fiber.StatusUnauthorized {
+		t.Fatalf("wrong code: status %d, want 401", status)
+	}
+	if status := verify(challenge, "bbbb-bbbb"); status != fiber.StatusUnauthorized {
+		t.Fatalf("challenge reused after wrong code: status %d, want 401", status)
+	}
+
+	// A new login supersedes an unused challenge.
+	stale := login()
+	challenge = login()
+	if status := verify(stale, "bbbb-bbbb"); status != fiber.StatusUnauthorized {
+		t.Fatalf("superseded challenge: status %d, want 401", status)
+	}
+	if status := verify(challenge, "bbbb-bbbb"); status != fiber.StatusOK {
+		t.Fatalf("latest challenge: status %d, want 200", status)
+	}
+}
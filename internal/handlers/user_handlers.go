@@ -2,36 +2,31 @@ package handlers
 
 import (
 	"errors"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
+	"github.com-Personal/go-fiber/internal/loginguard"
+	"github.com-Personal/go-fiber/internal/mailer"
 	"github.com-Personal/go-fiber/internal/models"
 	"github.com-Personal/go-fiber/internal/utils"
 	firebase_utils "github.com-Personal/go-fiber/internal/utils/firebase"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Mailer mailer.Mailer
+	Guard  *loginguard.Guard
+	// BaseURL is the configured public address of the app that links in
+	// emails and redirect URIs are built from.
+	BaseURL string
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{DB: db}
-}
-
-type SafeUser struct {
-	ID        uint      `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Bio       string    `json:"bio"`
-	AvatarURL string    `json:"avatar_url"`
-	CreatedAt time.Time `json:"created_at"`
+func NewUserHandler(db *gorm.DB, m mailer.Mailer, guard *loginguard.Guard, baseURL string) *UserHandler {
+	return &UserHandler{DB: db, Mailer: m, Guard: guard, BaseURL: baseURL}
 }
 
 type UserRegistration struct {
@@ -65,6 +60,19 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	reserved, err := usernameReserved(h.DB, userReg.Username, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+	if reserved {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Username is reserved by another user",
+		})
+	}
+
 	if err := h.DB.Where("email = ?", userReg.Email).First(&existingUser).Error; err == nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"message": "Email already exists",
@@ -83,6 +91,7 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 		Username: userReg.Username,
 		Email:    userReg.Email,
 		Password: string(hashedPassword),
+		Role:     models.RoleAuthor,
 	}
 
 	result := h.DB.Create(&newUser)
@@ -93,45 +102,23 @@ func (h *UserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	safeUser := SafeUser{
-		ID:        newUser.ID,
-		Username:  newUser.Username,
-		Email:     newUser.Email,
-		Bio:       newUser.Bio,
-		AvatarURL: newUser.AvatarURL,
-		CreatedAt: newUser.CreatedAt,
+	if err := h.sendVerificationEmail(c, newUser); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", newUser.ID, err)
 	}
 
-	accessToken, err := generateToken(newUser.ID, newUser.Username, time.Hour)
+	accessToken, refreshToken, err := startSession(h.DB, c, newUser)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to generate access token",
+			"message": "Failed to start session",
 			"error":   err.Error(),
 		})
 	}
 
-	refreshToken, err := generateToken(newUser.ID, newUser.Username, time.Hour*24*7)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to generate refresh token",
-			"error":   err.Error(),
-		})
-	}
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(time.Hour * 24 * 7),
-		Secure:   false,
-		Path:     "/",
-		HTTPOnly: true,
-		SameSite: "Strict",
-		Domain:   "localhost",
-	})
+	setRefreshTokenCookie(c, refreshToken)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message":       "User registered successfully",
-		"user":          safeUser,
+		"message":       "User registered successfully. Please check your email to verify your account",
+		"user":          selfView(newUser),
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
 	})
@@ -149,9 +136,14 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	if throttled, err := h.loginThrottled(c, loginData.Email); throttled {
+		return err
+	}
+
 	var user models.User
 	result := h.DB.Where("email = ?", loginData.Email).First(&user)
 	if result.Error != nil {
+		h.recordLoginFailure(c, loginData.Email, nil)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Invalid credentials",
 		})
@@ -159,98 +151,110 @@ func (h *UserHandler) Login(c *fiber.Ctx) error {
 
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password))
 	if err != nil {
+		h.recordLoginFailure(c, loginData.Email, &user)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Invalid credentials",
 		})
 	}
 
-	accessToken, err := generateToken(user.ID, user.Username, time.Hour)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to generate access token",
-			"error":   err.Error(),
+	return h.beginLogin(c, user)
+}
+
+// beginLogin is called once a user's primary credential has been verified.
+// Users with two-factor authentication get an MFA challenge instead of tokens.
+func (h *UserHandler) beginLogin(c *fiber.Ctx, user models.User) error {
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := utils.GenerateToken(user.ID, user.Username, "", "", utils.MFAToken, mfaChallengeTTL)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to generate MFA challenge",
+				"error":   err.Error(),
+			})
+		}
+
+		// The challenge is recorded so VerifyLoginMFA can redeem it only once.
+		if err := storeUserToken(h.DB, user.ID, models.MFAChallengeToken, mfaToken, mfaChallengeTTL); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to generate MFA challenge",
+				"error":   err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
 		})
 	}
 
-	refreshToken, err := generateToken(user.ID, user.Username, time.Hour*24*7)
+	return h.completeLogin(c, user)
+}
+
+// completeLogin issues an access token and a new refresh token family for a
+// user whose credentials have been fully verified.
+func (h *UserHandler) completeLogin(c *fiber.Ctx, user models.User) error {
+	if err := h.Guard.ResetAccount(user.Email); err != nil {
+		log.Printf("failed to reset login attempts for user %d: %v", user.ID, err)
+	}
+
+	accessToken, refreshToken, err := startSession(h.DB, c, user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to generate refresh token",
+			"message": "Failed to start session",
 			"error":   err.Error(),
 		})
 	}
 
-	safeUser := SafeUser{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		Bio:       user.Bio,
-		AvatarURL: user.AvatarURL,
-		CreatedAt: user.CreatedAt,
-	}
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(time.Hour * 24 * 7),
-		Secure:   false,
-		Path:     "/",
-		HTTPOnly: true,
-		SameSite: "Strict",
-		Domain:   "localhost",
-	})
+	setRefreshTokenCookie(c, refreshToken)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message":       "Login successful",
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
-		"user":          safeUser,
+		"user":          selfView(user),
 	})
 }
 
-func (h *UserHandler) CheckEmail(c *fiber.Ctx) error {
-	email := c.Params("email")
-	fmt.Println(email)
-
-	var user models.User
-	result := h.DB.Where("email = ?", email).First(&user)
-
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "Email not found",
-			})
-		}
-		// Handle any other database errors
+// GetAllUsernameAndEmails lists every username. Email addresses are only
+// filled in where the caller's view of that user includes them.
+func (h *UserHandler) GetAllUsernameAndEmails(c *fiber.Ctx) error {
+	v, err := currentViewer(h.DB, c)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Internal Server Error",
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Email found",
-	})
-}
-
-func (h *UserHandler) GetAllUsernameAndEmails(c *fiber.Ctx) error {
+	var records []models.User
+	if result := h.DB.Select("id", "email", "username", "show_email").Find(&records); result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Unable to fetch emails and usernames",
+		})
+	}
 
-	var users []struct {
+	type entry struct {
 		Email    string
 		Username string
 	}
-	if result := h.DB.Model(models.User{}).Select("email, username").Find(&users); result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Unable to fetch emails and usernames",
-		})
+	users := make([]entry, 0, len(records))
+	for _, record := range records {
+		users = append(users, entry{Email: v.view(record).Email, Username: record.Username})
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"Users": users,
 	})
 }
 
-func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
+func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "unauthorized user",
+		})
+	}
+
 	var data struct {
-		Email       string `json:"email"`
 		OldPassword string `json:"oldPassword"`
 		NewPassword string `json:"newPassword"`
 	}
@@ -263,14 +267,14 @@ func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
 	}
 
 	// Validate input
-	if data.Email == "" || data.OldPassword == "" || data.NewPassword == "" {
+	if data.OldPassword == "" || data.NewPassword == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Email, old password, and new password are required",
+			"message": "Old password and new password are required",
 		})
 	}
 
 	var user models.User
-	result := h.DB.Where("email = ?", data.Email).First(&user)
+	result := h.DB.First(&user, userID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -305,8 +309,15 @@ func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
 		})
 	}
 
+	// Whoever knew the old password is signed out everywhere but here.
+	currentID, _ := c.Locals("session_id").(string)
 	user.Password = string(hashedPassword)
-	if err := h.DB.Save(&user).Error; err != nil {
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return revokeOtherSessions(tx, user.ID, currentID)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to update password",
 			"error":   err.Error(),
@@ -314,37 +325,26 @@ func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Password reset successful",
+		"message": "Password changed successfully",
 	})
 }
 
 func (h *UserHandler) Logout(c *fiber.Ctx) error {
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		Expires:  time.Now().Add(-time.Hour),
-		Secure:   false,
-		Path:     "/",
-		HTTPOnly: true,
-		SameSite: "Strict",
-	})
-	return c.SendStatus(fiber.StatusOK)
-}
-
-func generateToken(userID uint, username string, expiration time.Duration) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"exp":      time.Now().Add(expiration).Unix(),
+	if refreshToken := c.Cookies("refresh_token"); refreshToken != "" {
+		if err := revokeRefreshToken(h.DB, refreshToken); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to revoke refresh token",
+				"error":   err.Error(),
+			})
+		}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte(utils.GetSecretOrEnv("JWT_SECRET_KEY"))
-	return token.SignedString(secretKey)
+
+	clearRefreshTokenCookie(c)
+	return c.SendStatus(fiber.StatusOK)
 }
 
 func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 	refreshToken := c.Cookies("refresh_token")
-	log.Printf("Received refresh token: %s", refreshToken)
 	if refreshToken == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Missing refresh token",
@@ -352,17 +352,46 @@ func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	claims, err := utils.ValidateToken(refreshToken)
-	if err != nil {
+	claims, err := utils.ValidateToken(refreshToken, utils.RefreshToken)
+	if err != nil || claims.SessionID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid or expired refresh token",
+		})
+	}
+
+	// Reload the user so role and username changes are reflected in the new
+	// access token.
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil {
+		clearRefreshTokenCookie(c)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Invalid or expired refresh token",
 		})
 	}
 
-	userID := uint(claims["user_id"].(float64))
-	username := claims["username"].(string)
+	newRefreshToken, err := rotateRefreshToken(h.DB, refreshToken, user.ID, user.Username)
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenReused) {
+			clearRefreshTokenCookie(c)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid or expired refresh token",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to rotate refresh token",
+			"error":   err.Error(),
+		})
+	}
 
-	newAccessToken, err := generateToken(userID, username, time.Hour)
+	if err := touchSession(h.DB, c, claims.SessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update session",
+			"error":   err.Error(),
+		})
+	}
+
+	newAccessToken, err := utils.GenerateToken(user.ID, user.Username, user.Role, claims.SessionID, utils.AccessToken, accessTokenTTL)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to generate new access token",
@@ -370,8 +399,11 @@ func (h *UserHandler) RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
+	setRefreshTokenCookie(c, newRefreshToken)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"access_token": newAccessToken,
+		"access_token":  newAccessToken,
+		"refresh_token": newRefreshToken,
 	})
 }
 
@@ -384,37 +416,64 @@ func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := h.DB.First(&user, userID).Error; err != nil {
+	if err := h.DB.Preload("SocialLinks", orderByID).First(&user, userID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"message": "User not found",
 		})
 	}
 
-	safeUser := SafeUser{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		Bio:       user.Bio,
-		AvatarURL: user.AvatarURL,
-		CreatedAt: user.CreatedAt,
-	}
-
-	return c.Status(fiber.StatusOK).JSON(safeUser)
+	return c.Status(fiber.StatusOK).JSON(selfView(user))
 }
 
 func (h *UserHandler) GetUserDetail(c *fiber.Ctx) error {
 	username := c.Params("username")
 	var user models.User
-	if err := h.DB.Where("username = ?", username).Find(&user).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "User not found",
+	if err := h.DB.Preload("SocialLinks", orderByID).Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if redirected, err := redirectRenamed(h.DB, c, username); redirected {
+				return err
+			}
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	v, err := currentViewer(h.DB, c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(user)
+
+	view := v.view(user)
+	if user.ID == v.id {
+		return c.Status(fiber.StatusOK).JSON(view)
+	}
+
+	following, followedBy, err := relationships(h.DB, v.id, []uint{user.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch relationship",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(view.withRelationship(following[user.ID], followedBy[user.ID]))
 }
 
 func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Params("id")
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "unauthorized user",
+		})
+	}
 
 	var user models.User
 	if err := h.DB.First(&user, userID).Error; err != nil {
@@ -424,9 +483,11 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 	}
 
 	var updateData struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Bio      string `json:"bio"`
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		IsPrivate *bool  `json:"is_private"`
+		ShowEmail *bool  `json:"show_email"`
+		profileFields
 	}
 
 	if err := c.BodyParser(&updateData); err != nil {
@@ -436,35 +497,137 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	if updateData.Username != "" {
+	updates := map[string]interface{}{}
+	emailChanged := false
+	oldUsername := ""
+
+	if err := updateData.profileFields.apply(&user, updates); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	var socialLinks []string
+	if updateData.SocialLinks != nil {
+		links, err := updateData.socialLinks()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		socialLinks = links
+	}
+
+	if updateData.Username != "" && updateData.Username != user.Username {
+		var count int64
+		if err := h.DB.Model(&models.User{}).Where("username = ? AND id <> ?", updateData.Username, user.ID).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Database error",
+				"error":   err.Error(),
+			})
+		}
+		if count > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Username already exists",
+			})
+		}
+		reserved, err := usernameReserved(h.DB, updateData.Username, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Database error",
+				"error":   err.Error(),
+			})
+		}
+		if reserved {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Username is reserved by another user",
+			})
+		}
+		updates["username"] = updateData.Username
+		oldUsername = user.Username
 		user.Username = updateData.Username
 	}
-	if updateData.Email != "" {
+	if updateData.Email != "" && updateData.Email != user.Email {
+		var count int64
+		if err := h.DB.Model(&models.User{}).Where("email = ? AND id <> ?", updateData.Email, user.ID).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Database error",
+				"error":   err.Error(),
+			})
+		}
+		if count > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Email already exists",
+			})
+		}
+		// A new address has to be verified again before the user can post.
+		updates["email"] = updateData.Email
+		updates["email_verified_at"] = nil
 		user.Email = updateData.Email
+		user.EmailVerifiedAt = nil
+		emailChanged = true
+	}
+	madePublic := false
+	if updateData.IsPrivate != nil && *updateData.IsPrivate != user.IsPrivate {
+		updates["is_private"] = *updateData.IsPrivate
+		madePublic = user.IsPrivate
+		user.IsPrivate = *updateData.IsPrivate
+	}
+
+	if updateData.ShowEmail != nil && *updateData.ShowEmail != user.ShowEmail {
+		updates["show_email"] = *updateData.ShowEmail
+		user.ShowEmail = *updateData.ShowEmail
+	}
+
+	if len(updates) > 0 || updateData.SocialLinks != nil {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if len(updates) > 0 {
+				if err := tx.Model(&user).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			if updateData.SocialLinks != nil {
+				if err := replaceSocialLinks(tx, user.ID, socialLinks); err != nil {
+					return err
+				}
+			}
+			// Old links keep working through the username history.
+			if oldUsername != "" {
+				if err := recordUsernameChange(tx, user.ID, oldUsername, user.Username); err != nil {
+					return err
+				}
+			}
+			// Nobody needs approval to follow a public account, so pending
+			// requests are accepted when the account is made public.
+			if madePublic {
+				return approveAllFollowRequests(tx, user.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to update profile",
+				"error":   err.Error(),
+			})
+		}
 	}
-	if updateData.Bio != "" {
-		user.Bio = updateData.Bio
+
+	if emailChanged {
+		if err := h.sendVerificationEmail(c, user); err != nil {
+			log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+		}
 	}
 
-	if err := h.DB.Save(&user).Error; err != nil {
+	if err := loadSocialLinks(h.DB, &user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to update profile",
+			"message": "Failed to fetch social links",
 			"error":   err.Error(),
 		})
 	}
 
-	safeUser := SafeUser{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		Bio:       user.Bio,
-		AvatarURL: user.AvatarURL,
-		CreatedAt: user.CreatedAt,
-	}
-
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Profile updated successfully",
-		"user":    safeUser,
+		"user":    selfView(user),
 	})
 }
 
@@ -480,7 +643,12 @@ func (h *UserHandler) GetAvatarImage(c *fiber.Ctx) error {
 }
 
 func (h *UserHandler) UploadAvatar(c *fiber.Ctx) error {
-	userID := c.Params("id")
+	userID, ok := c.Locals("user_id").(uint)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "unauthorized user",
+		})
+	}
 
 	var user models.User
 	if err := h.DB.First(&user, userID).Error; err != nil {
@@ -499,7 +667,7 @@ func (h *UserHandler) UploadAvatar(c *fiber.Ctx) error {
 
 	user.AvatarURL = imageURL
 
-	if err := h.DB.Save(&user).Error; err != nil {
+	if err := h.DB.Model(&user).Update("avatar_url", imageURL).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to update avatar URL",
 			"error":   err.Error(),
@@ -528,7 +696,33 @@ func (h *UserHandler) FollowUser(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.DB.Model(&follower).Association("Following").Append(&following); err != nil {
+	if follower.ID == following.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "You cannot follow yourself",
+		})
+	}
+
+	blocked, err := eitherBlocked(h.DB, follower.ID, following.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check blocks",
+			"error":   err.Error(),
+		})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "You cannot follow this user",
+		})
+	}
+
+	// Following a private account needs the owner's approval.
+	if following.IsPrivate {
+		return h.requestFollow(c, follower, following)
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return addFollow(tx, follower.ID, following.ID)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to follow user",
 			"error":   err.Error(),
@@ -556,68 +750,116 @@ func (h *UserHandler) UnfollowUser(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.DB.Model(&follower).Association("Following").Delete(&following); err != nil {
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return removeFollow(tx, follower.ID, following.ID)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to unfollow user",
 			"error":   err.Error(),
 		})
 	}
 
+	// Unfollowing also withdraws a pending follow request.
+	if err := h.DB.Where("follower_id = ? AND following_id = ?", follower.ID, following.ID).
+		Delete(&models.FollowRequest{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to cancel follow request",
+			"error":   err.Error(),
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Successfully unfollowed user",
 	})
 }
 
 func (h *UserHandler) GetFollowers(c *fiber.Ctx) error {
-	userID := c.Params("id")
+	return h.listFollows(c, "followers", "follower_id", "following_id")
+}
+
+func (h *UserHandler) GetFollowing(c *fiber.Ctx) error {
+	return h.listFollows(c, "following", "following_id", "follower_id")
+}
+
+// listFollows returns one page of the users on the listed side of the
+// user_followers rows whose other side is the requested user. Follows have
+// no timestamp, so pages are ordered by user ID, newest account first.
+func (h *UserHandler) listFollows(c *fiber.Ctx, key, listedColumn, ownerColumn string) error {
+	v, err := currentViewer(h.DB, c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check permissions",
+			"error":   err.Error(),
+		})
+	}
 
 	var user models.User
-	if err := h.DB.Preload("Followers").First(&user, userID).Error; err != nil {
+	if err := h.DB.First(&user, c.Params("id")).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"message": "User not found",
 		})
 	}
 
-	var safeFollowers []SafeUser
-	for _, follower := range user.Followers {
-		safeFollowers = append(safeFollowers, SafeUser{
-			ID:        follower.ID,
-			Username:  follower.Username,
-			Email:     follower.Email,
-			Bio:       follower.Bio,
-			AvatarURL: follower.AvatarURL,
-			CreatedAt: follower.CreatedAt,
-		})
+	if hidden, err := h.privateAccount(c, user); hidden {
+		return err
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"followers": safeFollowers,
-	})
-}
+	var afterID uint
+	hasCursor, err := decodeCursor(c, &afterID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid cursor",
+		})
+	}
 
-func (h *UserHandler) GetFollowing(c *fiber.Ctx) error {
-	userID := c.Params("id")
+	limit := pageSize(c)
+	query := h.DB.Model(&models.User{}).
+		Joins("JOIN user_followers ON user_followers."+listedColumn+" = users.id").
+		Where("user_followers."+ownerColumn+" = ?", user.ID)
+	if hasCursor {
+		query = query.Where("users.id < ?", afterID)
+	}
 
-	var user models.User
-	if err := h.DB.Preload("Following").First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "User not found",
+	var users []models.User
+	if err := query.Order("users.id DESC").Limit(limit + 1).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch " + key,
+			"error":   err.Error(),
 		})
 	}
 
-	var safeFollowing []SafeUser
-	for _, following := range user.Following {
-		safeFollowing = append(safeFollowing, SafeUser{
-			ID:        following.ID,
-			Username:  following.Username,
-			Email:     following.Email,
-			Bio:       following.Bio,
-			AvatarURL: following.AvatarURL,
-			CreatedAt: following.CreatedAt,
+	var nextCursor *string
+	if len(users) > limit {
+		users = users[:limit]
+		cursor := encodeCursor(users[limit-1].ID)
+		nextCursor = &cursor
+	}
+
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	following, followedBy, err := relationships(h.DB, v.id, ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch relationships",
+			"error":   err.Error(),
 		})
 	}
 
+	list := make([]UserView, 0, len(users))
+	for _, u := range users {
+		list = append(list, v.view(u).withRelationship(following[u.ID], followedBy[u.ID]))
+	}
+
+	total := user.FollowingCount
+	if ownerColumn == "following_id" {
+		total = user.FollowersCount
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"following": safeFollowing,
+		key:           list,
+		"count":       total,
+		"next_cursor": nextCursor,
 	})
 }
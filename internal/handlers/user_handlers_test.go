@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Changing the password signs out every other device, since whoever knew the
+// old one may still be logged in, but keeps the session making the change.
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newTestDB(t, &models.User{}, &models.Session{}, &models.RefreshToken{})
+	h := newTestUserHandler(t, db)
+	app := newTestApp()
+	app.Put("/users/me/password", func(c *fiber.Ctx) error {
+		c.Locals("session_id", "current")
+		return c.Next()
+	}, h.ChangePassword)
+
+	user := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com", Password: string(hash)})
+	other := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+	expires := time.Now().Add(time.Hour)
+	for _, s := range []models.Session{
+		{ID: "current", UserID: user.ID, ExpiresAt: expires},
+		{ID: "stolen", UserID: user.ID, ExpiresAt: expires},
+		{ID: "bobs", UserID: other.ID, ExpiresAt: expires},
+	} {
+		db.Create(&s)
+		db.Create(&models.RefreshToken{UserID: s.UserID, FamilyID: s.ID, TokenHash: s.ID + "-hash", ExpiresAt: expires})
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/users/me/password", strings.NewReader(`{"oldPassword":"correct horse","newPassword":"battery staple"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, body := send(t, app, asUser(req, user.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+
+	for id, wantRevoked := range map[string]bool{"current": false, "stolen": true, "bobs": false} {
+		var session models.Session
+		db.First(&session, "id = ?", id)
+		if revoked := session.RevokedAt != nil; revoked != wantRevoked {
+			t.Errorf("session %q revoked = %v, want %v", id, revoked, wantRevoked)
+		}
+
+		var token models.RefreshToken
+		db.First(&token, "family_id = ?", id)
+		if revoked := token.RevokedAt != nil; revoked != wantRevoked {
+			t.Errorf("refresh token of %q revoked = %v, want %v", id, revoked, wantRevoked)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// createUserToken issues a single-use token for the given purpose. Any earlier
+// unused tokens for the same purpose are invalidated so only the most recent
+// link works.
+func createUserToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeUserToken(db, userID, purpose, token, ttl); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// storeUserToken records an already generated token for the given purpose,
+// invalidating any earlier unused ones.
+func storeUserToken(db *gorm.DB, userID uint, purpose, token string, ttl time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+}
+
+// consumeUserToken marks a token as used inside tx and returns it. The row is
+// locked so a token can only ever be redeemed once.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var stored models.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).
+		First(&stored).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, errInvalidUserToken
+	}
+
+	if err := tx.Model(&stored).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
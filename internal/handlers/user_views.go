@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// UserView is the only shape in which users are serialized. Which fields are
+// filled depends on who is looking: anyone gets the public view, the user
+// gets the self view and admins get the admin view of other users.
+type UserView struct {
+	ID             uint      `json:"id"`
+	Username       string    `json:"username"`
+	DisplayName    string    `json:"display_name"`
+	Email          string    `json:"email,omitempty"`
+	Bio            string    `json:"bio"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	Pronouns       string    `json:"pronouns"`
+	AvatarURL      string    `json:"avatar_url"`
+	CoverImageURL  string    `json:"cover_image_url"`
+	IsPrivate      bool      `json:"is_private"`
+	FollowersCount int       `json:"followers_count"`
+	FollowingCount int       `json:"following_count"`
+	PostsCount     int       `json:"posts_count"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Only filled where the handler loaded them, such as full profiles.
+	SocialLinks []models.SocialLink `json:"social_links,omitempty"`
+
+	// Self and admin views only.
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"`
+	Role             string     `json:"role,omitempty"`
+	TwoFactorEnabled *bool      `json:"two_factor_enabled,omitempty"`
+	ShowEmail        *bool      `json:"show_email,omitempty"`
+
+	// Admin view only.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// Relationship to the caller, left out when they look at themselves.
+	IsFollowing *bool `json:"is_following,omitempty"`
+	FollowsYou  *bool `json:"follows_you,omitempty"`
+}
+
+// publicView shows what anyone may see. The email address is only included
+// if the user has chosen to show it. Deleted accounts, whose posts can stay
+// up, show as deletedUsername and nothing else.
+func publicView(user models.User) UserView {
+	if user.DeletedAt.Valid {
+		return UserView{ID: user.ID, Username: deletedUsername}
+	}
+	view := UserView{
+		ID:             user.ID,
+		Username:       user.Username,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		Location:       user.Location,
+		Website:        user.Website,
+		Pronouns:       user.Pronouns,
+		AvatarURL:      user.AvatarURL,
+		CoverImageURL:  user.CoverImageURL,
+		IsPrivate:      user.IsPrivate,
+		FollowersCount: user.FollowersCount,
+		FollowingCount: user.FollowingCount,
+		PostsCount:     user.PostsCount,
+		CreatedAt:      user.CreatedAt,
+		SocialLinks:    user.SocialLinks,
+	}
+	if user.ShowEmail {
+		view.Email = user.Email
+	}
+	return view
+}
+
+// withDeletedUsers lets a preload of the author of a post or revision load
+// deleted accounts too, so they are shown as deleted rather than left empty.
+func withDeletedUsers(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// selfView adds the account details and privacy settings of the caller's own
+// account.
+func selfView(user models.User) UserView {
+	view := publicView(user)
+	twoFactorEnabled := user.TOTPEnabledAt != nil
+	showEmail := user.ShowEmail
+
+	view.Email = user.Email
+	view.EmailVerifiedAt = user.EmailVerifiedAt
+	view.Role = user.Role
+	view.TwoFactorEnabled = &twoFactorEnabled
+	view.ShowEmail = &showEmail
+	return view
+}
+
+// adminView is the self view plus bookkeeping fields, for moderators looking
+// at someone else's account.
+func adminView(user models.User) UserView {
+	view := selfView(user)
+	updatedAt := user.UpdatedAt
+	view.UpdatedAt = &updatedAt
+	return view
+}
+
+// withRelationship records whether the caller follows the user and the
+// other way round.
+func (v UserView) withRelationship(isFollowing, followsYou bool) UserView {
+	v.IsFollowing = &isFollowing
+	v.FollowsYou = &followsYou
+	return v
+}
+
+// viewer is the caller, as far as choosing a view is concerned.
+type viewer struct {
+	id    uint
+	admin bool
+}
+
+// currentViewer identifies the caller. The role in the access token is only
+// trusted to rule admin fields out; an admin claim is checked against the
+// database so a demoted admin stops seeing them straight away.
+func currentViewer(db *gorm.DB, c *fiber.Ctx) (viewer, error) {
+	userID := c.Locals("user_id").(uint)
+	role, _ := c.Locals("role").(string)
+	if !policy.HasPermission(role, policy.UsersManage) {
+		return viewer{id: userID}, nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+		return viewer{}, err
+	}
+	return viewer{id: userID, admin: policy.HasPermission(user.Role, policy.UsersManage)}, nil
+}
+
+// view picks the view of user that v is allowed to see.
+func (v viewer) view(user models.User) UserView {
+	switch {
+	case user.ID == v.id:
+		return selfView(user)
+	case v.admin:
+		return adminView(user)
+	default:
+		return publicView(user)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const defaultUsernameReservation = 30 * 24 * time.Hour
+
+// maxReservedUsernames is how many old usernames stay reserved for a user at
+// once. Renaming again releases the oldest, so nobody can hold on to any
+// number of names by renaming over and over.
+const maxReservedUsernames = 3
+
+// usernameReservation is how long a username someone gave up stays reserved
+// for them, set with USERNAME_RESERVATION_PERIOD.
+func usernameReservation() time.Duration {
+	period, err := time.ParseDuration(utils.GetSecretOrEnv("USERNAME_RESERVATION_PERIOD"))
+	if err != nil || period < 0 {
+		return defaultUsernameReservation
+	}
+	return period
+}
+
+// usernameReserved reports whether username was recently given up by
+// someone other than userID and can't be taken yet.
+func usernameReserved(db *gorm.DB, username string, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.UsernameHistory{}).
+		Where("username = ? AND user_id <> ? AND reserved_until > ?", username, userID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// recordUsernameChange keeps the old name of a renamed user. Taking back a
+// name of one's own drops it from the history. Beyond maxReservedUsernames
+// the oldest reservations end now; their names still redirect until someone
+// else takes them.
+func recordUsernameChange(tx *gorm.DB, userID uint, oldUsername, newUsername string) error {
+	if err := tx.Where("user_id = ? AND username = ?", userID, newUsername).
+		Delete(&models.UsernameHistory{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Create(&models.UsernameHistory{
+		UserID:        userID,
+		Username:      oldUsername,
+		ReservedUntil: now.Add(usernameReservation()),
+		ChangedAt:     now,
+	}).Error; err != nil {
+		return err
+	}
+
+	var released []uint
+	if err := tx.Model(&models.UsernameHistory{}).
+		Where("user_id = ? AND reserved_until > ?", userID, now).
+		Order("changed_at DESC").Order("id DESC").
+		Offset(maxReservedUsernames).
+		Pluck("id", &released).Error; err != nil {
+		return err
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	return tx.Model(&models.UsernameHistory{}).Where("id IN ?", released).
+		Update("reserved_until", now).Error
+}
+
+// renamedUser finds the user who last gave up username. Callers only ask
+// once no current user has the name.
+func renamedUser(db *gorm.DB, username string) (*models.User, error) {
+	var entry models.UsernameHistory
+	if err := db.Where("username = ?", username).Order("changed_at DESC").First(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := db.First(&user, entry.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// redirectRenamed answers a request addressed by an old username with a
+// permanent redirect to the same route under the current one. It reports
+// false when the username was never used.
+func redirectRenamed(db *gorm.DB, c *fiber.Ctx, username string) (bool, error) {
+	user, err := renamedUser(db, username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Database error",
+			"error":   err.Error(),
+		})
+	}
+
+	location := routeWithParam(c, "username", user.Username)
+	c.Location(location)
+	return true, c.Status(fiber.StatusMovedPermanently).JSON(fiber.Map{
+		"message":  "This user has changed their username",
+		"username": user.Username,
+		"location": location,
+	})
+}
+
+// routeWithParam rebuilds the current route with the parameter name set to
+// value, keeping the query string. Other parameters are copied as they
+// arrived, still escaped.
+func routeWithParam(c *fiber.Ctx, name, value string) string {
+	route := c.Route()
+	path := route.Path
+	for _, param := range route.Params {
+		arrived := c.Params(param)
+		if param == name {
+			arrived = url.PathEscape(value)
+		}
+		path = strings.Replace(path, ":"+param, arrived, 1)
+	}
+
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		path += "?" + string(query)
+	}
+	return path
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRenamesReserveOnlyRecentUsernames(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.UsernameHistory{})
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+
+	names := []string{"alice", "alice2", "alice3", "alice4", "alice5"}
+	for i := 1; i < len(names); i++ {
+		if err := recordUsernameChange(db, alice.ID, names[i-1], names[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, name := range names[:len(names)-1] {
+		reserved, err := usernameReserved(db, name, bob.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i >= len(names)-1-maxReservedUsernames; reserved != want {
+			t.Errorf("%s reserved = %v, want %v", name, reserved, want)
+		}
+	}
+
+	// Taking back an old name frees its reservation slot.
+	if err := recordUsernameChange(db, alice.ID, "alice5", "alice4"); err != nil {
+		t.Fatal(err)
+	}
+	var active int64
+	db.Model(&models.UsernameHistory{}).Where("user_id = ? AND reserved_until > ?", alice.ID, time.Now()).Count(&active)
+	if active > maxReservedUsernames {
+		t.Fatalf("%d usernames reserved, want at most %d", active, maxReservedUsernames)
+	}
+}
+
+func TestOldUsernameRedirects(t *testing.T) {
+	db := newTestDB(t, &models.User{}, &models.UsernameHistory{}, &models.SocialLink{},
+		&models.Post{}, &models.PostSlugHistory{}, &models.UserBlock{}, &models.UserMute{})
+	alice := createTestUser(t, db, models.User{Username: "alice", Email: "alice@example.com"})
+	db.Create(&models.Post{Title: "Hello", Slug: "hello", UserID: alice.ID, Status: models.PostPublished})
+	db.Model(&alice).Update("username", "alice_new")
+	if err := recordUsernameChange(db, alice.ID, "alice", "alice_new"); err != nil {
+		t.Fatal(err)
+	}
+	bob := createTestUser(t, db, models.User{Username: "bob", Email: "bob@example.com"})
+
+	users := newTestUserHandler(t, db)
+	posts := NewPostHandler(db)
+	app := newTestApp()
+	app.Get("/users/:username", users.GetUserDetail)
+	app.Get("/posts/:username/:slug", posts.GetPostBySlug)
+
+	tests := []struct{ target, location string }{
+		{"/users/alice", "/users/alice_new"},
+		{"/posts/alice/hello", "/posts/alice_new/hello"},
+	}
+	for _, tt := range tests {
+		resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, tt.target, nil), bob.ID))
+		expectStatus(t, resp, body, fiber.StatusMovedPermanently)
+		if got := resp.Header.Get(fiber.HeaderLocation); got != tt.location {
+			t.Errorf("%s redirects to %q, want %q", tt.target, got, tt.location)
+		}
+	}
+
+	// Once someone else has the name, it is theirs.
+	createTestUser(t, db, models.User{Username: "alice", Email: "other-alice@example.com"})
+	resp, body := send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/users/alice", nil), bob.ID))
+	expectStatus(t, resp, body, fiber.StatusOK)
+	resp, body = send(t, app, asUser(httptest.NewRequest(http.MethodGet, "/posts/alice/hello", nil), bob.ID))
+	expectStatus(t, resp, body, fiber.StatusNotFound)
+}
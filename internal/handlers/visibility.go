@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func followsUser(db *gorm.DB, followerID, followingID uint) (bool, error) {
+	var count int64
+	err := db.Table("user_followers").
+		Where("follower_id = ? AND following_id = ?", followerID, followingID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// canSeeContent reports whether the viewer may see the owner's posts and
+// follower lists. Private accounts only show them to approved followers.
+func canSeeContent(db *gorm.DB, viewerID uint, owner models.User) (bool, error) {
+	if !owner.IsPrivate || owner.ID == viewerID {
+		return true, nil
+	}
+	return followsUser(db, viewerID, owner.ID)
+}
+
+// canSeePost applies canSeeContent to the author of a post, including one
+// whose account was deleted and whose posts were kept. Missing posts, posts
+// that aren't published unless the viewer wrote them, and posts of users on
+// either side of a block with the viewer are reported as not visible.
+func canSeePost(db *gorm.DB, viewerID uint, postID interface{}) (bool, error) {
+	var owner models.User
+	err := db.Unscoped().Joins("JOIN posts ON posts.user_id = users.id").
+		Where("posts.id = ? AND posts.deleted_at IS NULL", postID).
+		Where("(posts.status = ? OR posts.user_id = ?)", models.PostPublished, viewerID).
+		First(&owner).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	blocked, err := eitherBlocked(db, viewerID, owner.ID)
+	if err != nil || blocked {
+		return false, err
+	}
+	return canSeeContent(db, viewerID, owner)
+}
+
+// visiblePosts limits a posts query to published posts by authors whose
+// content the viewer may see, and to the viewer's own posts.
+func visiblePosts(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"(posts.user_id = ? OR (posts.status = ? AND "+
+				"(posts.user_id IN (SELECT id FROM users WHERE is_private = false) "+
+				"OR posts.user_id IN (SELECT following_id FROM user_followers WHERE follower_id = ?))))",
+			viewerID, models.PostPublished, viewerID,
+		)
+	}
+}
+
+// listedPosts limits a posts query to what the viewer may see in post lists
+// and search results.
+func listedPosts(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(visiblePosts(viewerID), withoutHiddenUsers("posts.user_id", viewerID))
+	}
+}
+
+// postNotVisible responds with 404 when the viewer may not see a post, so
+// that posts of private accounts aren't revealed to non-followers.
+func postNotVisible(db *gorm.DB, c *fiber.Ctx, postID interface{}) (bool, error) {
+	visible, err := canSeePost(db, c.Locals("user_id").(uint), postID)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check post visibility",
+			"error":   err.Error(),
+		})
+	}
+	if !visible {
+		return true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Post not found",
+		})
+	}
+	return false, nil
+}
+
+// blockedUsersQuery selects the users on either side of a block with a
+// viewer.
+const blockedUsersQuery = "SELECT blocked_id FROM user_blocks WHERE blocker_id = ? " +
+	"UNION SELECT blocker_id FROM user_blocks WHERE blocked_id = ?"
+
+// hiddenUsersQuery selects the users whose content is kept from a viewer:
+// anyone on either side of a block with them, and anyone they muted.
+const hiddenUsersQuery = blockedUsersQuery +
+	" UNION SELECT muted_id FROM user_mutes WHERE muter_id = ?"
+
+// withoutHiddenUsers drops rows whose column names a user hidden from the
+// viewer.
+func withoutHiddenUsers(column string, viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" NOT IN ("+hiddenUsersQuery+")", viewerID, viewerID, viewerID)
+	}
+}
+
+// withoutBlockedUsers drops rows whose column names a user on either side of
+// a block with the viewer. Unlike withoutHiddenUsers it lets muted users
+// through, for content the viewer asked for by name.
+func withoutBlockedUsers(column string, viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" NOT IN ("+blockedUsersQuery+")", viewerID, viewerID)
+	}
+}
+
+// eitherBlocked reports whether either user has blocked the other.
+func eitherBlocked(db *gorm.DB, a, b uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,69 @@
+package loginguard
+
+import (
+	"errors"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps attempts in the login_attempts table so every API instance
+// sees the same counters.
+type DBStore struct {
+	DB *gorm.DB
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{DB: db}
+}
+
+func (s *DBStore) Get(key string) (Attempt, error) {
+	var record models.LoginAttempt
+	err := s.DB.Where("key = ?", key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Attempt{}, nil
+	}
+	if err != nil {
+		return Attempt{}, err
+	}
+	return toAttempt(record), nil
+}
+
+func (s *DBStore) Update(key string, fn func(*Attempt)) (Attempt, error) {
+	var attempt Attempt
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var record models.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&record).Error; err != nil {
+			return err
+		}
+
+		attempt = toAttempt(record)
+		fn(&attempt)
+
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"failures":        attempt.Failures,
+			"last_failure_at": attempt.LastFailureAt,
+			"locked_until":    attempt.LockedUntil,
+		}).Error
+	})
+	return attempt, err
+}
+
+func (s *DBStore) Delete(key string) error {
+	return s.DB.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func toAttempt(record models.LoginAttempt) Attempt {
+	return Attempt{
+		Failures:      record.Failures,
+		LastFailureAt: record.LastFailureAt,
+		LockedUntil:   record.LockedUntil,
+	}
+}
@@ -0,0 +1,138 @@
+package loginguard
+
+import (
+	"strings"
+	"time"
+)
+
+// Attempt is the failed-login state tracked for one key.
+type Attempt struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Store keeps attempt state. MemoryStore suits a single instance; DBStore
+// shares state between instances.
+type Store interface {
+	Get(key string) (Attempt, error)
+	// Update atomically applies fn to the attempt stored under key.
+	Update(key string, fn func(*Attempt)) (Attempt, error)
+	Delete(key string) error
+}
+
+type Config struct {
+	// MaxFailures locks an account after this many consecutive failures.
+	MaxFailures int
+	// IPMaxFailures locks a client IP after this many failures across all
+	// accounts.
+	IPMaxFailures int
+	// LockoutDuration is how long a lock lasts unless lifted earlier.
+	LockoutDuration time.Duration
+	// FreeFailures are allowed before backoff starts; each further failure
+	// doubles the delay, starting at BaseDelay and capped at MaxDelay.
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// ResetAfter forgets failures when nothing has failed for this long.
+	ResetAfter time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxFailures:     5,
+		IPMaxFailures:   50,
+		LockoutDuration: 15 * time.Minute,
+		FreeFailures:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		ResetAfter:      time.Hour,
+	}
+}
+
+type Guard struct {
+	Store  Store
+	Config Config
+}
+
+func New(store Store, cfg Config) *Guard {
+	return &Guard{Store: store, Config: cfg}
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter reports how long the caller must wait before another attempt
+// for any of the given keys is allowed. Zero means go ahead.
+func (g *Guard) RetryAfter(keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		attempt, err := g.Store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := attempt.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// FailAccount records a failed login for an account and reports whether the
+// account has just been locked.
+func (g *Guard) FailAccount(email string) (bool, error) {
+	return g.fail(AccountKey(email), g.Config.MaxFailures)
+}
+
+// FailIP records a failed login from an IP and reports whether the IP has
+// just been locked.
+func (g *Guard) FailIP(ip string) (bool, error) {
+	return g.fail(IPKey(ip), g.Config.IPMaxFailures)
+}
+
+func (g *Guard) fail(key string, maxFailures int) (bool, error) {
+	now := time.Now()
+	locked := false
+
+	_, err := g.Store.Update(key, func(a *Attempt) {
+		if now.Sub(a.LastFailureAt) > g.Config.ResetAfter {
+			a.Failures = 0
+		}
+		a.Failures++
+		a.LastFailureAt = now
+
+		switch {
+		case a.Failures >= maxFailures:
+			wasLocked := a.LockedUntil.After(now)
+			a.LockedUntil = now.Add(g.Config.LockoutDuration)
+			locked = !wasLocked || a.Failures == maxFailures
+		case a.Failures > g.Config.FreeFailures:
+			a.LockedUntil = now.Add(g.backoff(a.Failures - g.Config.FreeFailures))
+		}
+	})
+	return locked, err
+}
+
+func (g *Guard) backoff(n int) time.Duration {
+	delay := g.Config.BaseDelay
+	for i := 1; i < n && delay < g.Config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.Config.MaxDelay {
+		delay = g.Config.MaxDelay
+	}
+	return delay
+}
+
+// ResetAccount clears the failures of an account after a successful login
+// or an unlock. IP counters are left alone so that logging into one's own
+// account can't be used to keep guessing at others.
+func (g *Guard) ResetAccount(email string) error {
+	return g.Store.Delete(AccountKey(email))
+}
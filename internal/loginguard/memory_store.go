@@ -0,0 +1,57 @@
+package loginguard
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps attempts in process memory. Entries that have not failed
+// for a day are dropped on the next write.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+	swept    time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]Attempt)}
+}
+
+func (s *MemoryStore) Get(key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(*Attempt)) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+
+	attempt := s.attempts[key]
+	fn(&attempt)
+	s.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.swept) < time.Hour {
+		return
+	}
+	s.swept = now
+
+	for key, attempt := range s.attempts {
+		if now.Sub(attempt.LastFailureAt) > 24*time.Hour && now.After(attempt.LockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/utils"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by MAIL_DRIVER: smtp (the default), which
+// needs SMTP_HOST, or log for local development. The log driver has to be
+// asked for explicitly, since it writes reset and unlock links where anyone
+// with access to the logs or MAIL_DIR can use them.
+func New() (Mailer, error) {
+	from := utils.GetSecretOrEnv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	driver := utils.GetSecretOrEnv("MAIL_DRIVER")
+	if driver == "" {
+		driver = "smtp"
+	}
+
+	switch driver {
+	case "log":
+		dir := utils.GetSecretOrEnv("MAIL_DIR")
+		if dir == "" {
+			log.Printf("WARNING: MAIL_DRIVER=log: emails, including password reset and unlock links, are written to the log instead of being sent")
+		} else {
+			log.Printf("WARNING: MAIL_DRIVER=log: emails, including password reset and unlock links, are written to %s instead of being sent", dir)
+		}
+		return &LogMailer{Dir: dir, From: from}, nil
+	case "smtp":
+	default:
+		return nil, fmt.Errorf("invalid MAIL_DRIVER %q: must be smtp or log", driver)
+	}
+
+	host := utils.GetSecretOrEnv("SMTP_HOST")
+	if host == "" {
+		return nil, errors.New("SMTP_HOST is required unless MAIL_DRIVER=log")
+	}
+
+	port := utils.GetSecretOrEnv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: utils.GetSecretOrEnv("SMTP_USERNAME"),
+		Password: utils.GetSecretOrEnv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// LogMailer writes messages to Dir as .eml files, or to the log when Dir is
+// empty, instead of delivering them.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(msg.To, "@", "_at_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
+
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerSanitizer.Replace(from) + "\r\n")
+	b.WriteString("To: " + headerSanitizer.Replace(msg.To) + "\r\n")
+	b.WriteString("Subject: " + headerSanitizer.Replace(msg.Subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import "testing"
+
+func TestNewRequiresExplicitLogDriver(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{name: "smtp by default", host: "smtp.example.com", want: "smtp"},
+		{name: "no SMTP host", wantErr: true},
+		{name: "smtp without host", driver: "smtp", wantErr: true},
+		{name: "log", driver: "log", want: "log"},
+		{name: "log ignores SMTP host", driver: "log", host: "smtp.example.com", want: "log"},
+		{name: "unknown driver", driver: "sendmail", host: "smtp.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAIL_DRIVER", tt.driver)
+			t.Setenv("SMTP_HOST", tt.host)
+			t.Setenv("MAIL_DIR", t.TempDir())
+
+			m, err := New()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("New() = %T, want an error", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New(): %v", err)
+			}
+
+			switch m.(type) {
+			case *SMTPMailer:
+				if tt.want != "smtp" {
+					t.Fatalf("New() = SMTP mailer, want %s", tt.want)
+				}
+			case *LogMailer:
+				if tt.want != "log" {
+					t.Fatalf("New() = log mailer, want %s", tt.want)
+				}
+			}
+		})
+	}
+}
@@ -2,12 +2,20 @@ package middleware
 
 import (
 	"strings"
+	"time"
 
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
 	"github.com-Personal/go-fiber/internal/utils"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() fiber.Handler {
+// lastUsedResolution limits how often last_used_at and last_seen_at are
+// written for a busy personal access token or session.
+const lastUsedResolution = time.Minute
+
+func AuthMiddleware(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		accessToken := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
 
@@ -21,16 +29,84 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		claims, err := utils.ValidateToken(accessToken)
-		if err != nil {
+		if strings.HasPrefix(accessToken, models.PersonalAccessTokenPrefix) {
+			return authenticatePersonalAccessToken(db, c, accessToken)
+		}
+
+		claims, err := utils.ValidateToken(accessToken, utils.AccessToken)
+		if err != nil || claims.SessionID == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"message": "Invalid or expired access token",
 			})
 		}
 
-		userID := uint(claims["user_id"].(float64))
-		c.Locals("user_id", userID)
-		c.Locals("username", claims["username"])
+		if !activeSession(db, claims) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Session has been revoked",
+			})
+		}
+
+		c.Locals("user_id", claims.UserID)
+		c.Locals("username", claims.Username)
+		c.Locals("role", claims.Role)
+		c.Locals("session_id", claims.SessionID)
 		return c.Next()
 	}
 }
+
+// activeSession reports whether the session an access token belongs to is
+// still live, and records that it was seen.
+func activeSession(db *gorm.DB, claims *utils.TokenClaims) bool {
+	var session models.Session
+	err := db.Select("id", "revoked_at", "last_seen_at").
+		Where("id = ? AND user_id = ?", claims.SessionID, claims.UserID).
+		First(&session).Error
+	if err != nil || session.RevokedAt != nil {
+		return false
+	}
+
+	if now := time.Now(); now.Sub(session.LastSeenAt) > lastUsedResolution {
+		db.Model(&session).Update("last_seen_at", now)
+	}
+	return true
+}
+
+func authenticatePersonalAccessToken(db *gorm.DB, c *fiber.Ctx, token string) error {
+	var pat models.PersonalAccessToken
+	err := db.Where("token_hash = ? AND revoked_at IS NULL", utils.HashToken(token)).First(&pat).Error
+	if err != nil || (pat.ExpiresAt != nil && time.Now().After(*pat.ExpiresAt)) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid or expired access token",
+		})
+	}
+
+	scope, ok := requiredScope(c.Method(), c.Path())
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Personal access tokens cannot be used for this endpoint",
+		})
+	}
+	if !policy.HasScope(pat.Scopes, scope) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Token is missing the " + scope + " scope",
+		})
+	}
+
+	var user models.User
+	if err := db.Select("id", "username", "role").First(&user, pat.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid or expired access token",
+		})
+	}
+
+	now := time.Now()
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > lastUsedResolution {
+		db.Model(&pat).Update("last_used_at", now)
+	}
+
+	c.Locals("user_id", user.ID)
+	c.Locals("username", user.Username)
+	c.Locals("role", user.Role)
+	c.Locals("token_scopes", []string(pat.Scopes))
+	return c.Next()
+}
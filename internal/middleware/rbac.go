@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com-Personal/go-fiber/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// RequirePermission must run after AuthMiddleware. Sensitive permissions, and
+// tokens issued before roles existed, are checked against the role stored in
+// the database instead of the one embedded in the token.
+func RequirePermission(db *gorm.DB, permission policy.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+
+		if role == "" || policy.IsSensitive(permission) {
+			userID, ok := c.Locals("user_id").(uint)
+			if !ok {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"message": "unauthorized user",
+				})
+			}
+
+			var user models.User
+			if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"message": "User not found",
+				})
+			}
+			role = user.Role
+			c.Locals("role", role)
+		}
+
+		if !policy.HasPermission(role, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "You do not have permission to perform this action",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com-Personal/go-fiber/internal/policy"
+)
+
+// tokenRoutes lists the routes personal access tokens may call and the scope
+// each one needs. Anything not listed, such as account settings or token
+// management, requires a password login. More specific patterns come first.
+var tokenRoutes = []struct {
+	method  string
+	pattern string
+	scope   string
+}{
+	{"GET", "/posts/:id/comments", policy.ScopeCommentsRead},
+	{"POST", "/posts/:id/comments", policy.ScopeCommentsWrite},
+	{"PUT", "/comments/:id", policy.ScopeCommentsWrite},
+	{"DELETE", "/comments/:id", policy.ScopeCommentsWrite},
+
+	{"GET", "/posts", policy.ScopePostsRead},
+	{"GET", "/posts/:post_id/reactions", policy.ScopePostsRead},
+	{"GET", "/posts/:username/:slug", policy.ScopePostsRead},
+	{"GET", "/users/:id/posts", policy.ScopePostsRead},
+	{"GET", "/uploads/:filename", policy.ScopePostsRead},
+	{"GET", "/search", policy.ScopePostsRead},
+	{"POST", "/posts", policy.ScopePostsWrite},
+	{"PUT", "/posts/:id", policy.ScopePostsWrite},
+	{"DELETE", "/posts/:id", policy.ScopePostsWrite},
+	{"POST", "/posts/:id/publish", policy.ScopePostsWrite},
+	{"POST", "/posts/:id/unpublish", policy.ScopePostsWrite},
+	{"POST", "/posts/:id/schedule", policy.ScopePostsWrite},
+	{"POST", "/posts/:id/archive", policy.ScopePostsWrite},
+	{"GET", "/posts/:id/revisions", policy.ScopePostsRead},
+	{"GET", "/posts/:id/revisions/diff", policy.ScopePostsRead},
+	{"GET", "/posts/:id/revisions/:number", policy.ScopePostsRead},
+	{"POST", "/posts/:id/revisions/:number/restore", policy.ScopePostsWrite},
+
+	{"GET", "/users", policy.ScopeProfileRead},
+	{"GET", "/users/:username", policy.ScopeProfileRead},
+}
+
+// requiredScope returns the scope a personal access token needs for a request,
+// or false if tokens may not call it at all.
+func requiredScope(method, path string) (string, bool) {
+	if method == "HEAD" {
+		method = "GET"
+	}
+
+	segments := splitPath(path)
+	for _, route := range tokenRoutes {
+		if route.method == method && matchPattern(splitPath(route.pattern), segments) {
+			return route.scope, true
+		}
+	}
+	return "", false
+}
+
+func matchPattern(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// RequireVerifiedEmail must run after AuthMiddleware. It rejects users who
+// have not confirmed their email address yet.
+func RequireVerifiedEmail(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "unauthorized user",
+			})
+		}
+
+		var user models.User
+		if err := db.Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+
+		if user.EmailVerifiedAt == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Please verify your email address first",
+			})
+		}
+
+		return c.Next()
+	}
+}
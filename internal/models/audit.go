@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	AuditAccountLocked    = "account_locked"
+	AuditAccountUnlocked  = "account_unlocked"
+	AuditIPLocked         = "ip_locked"
+	AuditIdentityLinked   = "identity_linked"
+	AuditIdentityUnlinked = "identity_unlinked"
+	AuditAccountDeleted   = "account_deleted"
+)
+
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	Event     string    `json:"event" gorm:"not null;index"`
+	IP        string    `json:"ip"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginAttempt backs the shared login throttling store. Key identifies an
+// account or a client IP.
+type LoginAttempt struct {
+	Key           string    `json:"key" gorm:"primaryKey"`
+	Failures      int       `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is
+// built in the background and can be downloaded until ExpiresAt.
+type DataExport struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Format      string     `json:"format" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
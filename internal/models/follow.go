@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// FollowRequest is a pending follow of a private account, waiting for the
+// account owner to approve or reject it.
+type FollowRequest struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	FollowerID  uint      `json:"follower_id" gorm:"not null;uniqueIndex:idx_follow_request"`
+	Follower    User      `json:"follower" gorm:"foreignKey:FollowerID"`
+	FollowingID uint      `json:"following_id" gorm:"not null;uniqueIndex:idx_follow_request;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserBlock stops two users from following or interacting with each other
+// and hides each from the other.
+type UserBlock struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BlockerID uint      `json:"blocker_id" gorm:"not null;uniqueIndex:idx_user_block"`
+	BlockedID uint      `json:"blocked_id" gorm:"not null;uniqueIndex:idx_user_block;index"`
+	Blocked   User      `json:"blocked" gorm:"foreignKey:BlockedID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserMute hides the muted user's content from the muter only.
+type UserMute struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MuterID   uint      `json:"muter_id" gorm:"not null;uniqueIndex:idx_user_mute"`
+	MutedID   uint      `json:"muted_id" gorm:"not null;uniqueIndex:idx_user_mute"`
+	Muted     User      `json:"muted" gorm:"foreignKey:MutedID"`
+	CreatedAt time.Time `json:"created_at"`
+}
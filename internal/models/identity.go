@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// UserIdentity links an account to a user at an external OpenID Connect
+// provider. A user can link at most one identity per provider.
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_user_identity_user_provider"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_user_identity_subject;uniqueIndex:idx_user_identity_user_provider"`
+	Subject   string    `json:"-" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthState remembers an authorization request between the redirect to the
+// provider and its callback. UserID is set when an existing user is linking
+// a new identity rather than logging in. BindingHash is the hash of a cookie
+// set on the browser that started the request, which only it can send back.
+type OAuthState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"not null;uniqueIndex"`
+	BindingHash  string    `gorm:"not null;default:''"`
+	Provider     string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	UserID       *uint     `gorm:"index"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
@@ -7,21 +7,36 @@ import (
 	"gorm.io/gorm"
 )
 
+// A post starts as a draft and only its author sees it until it is
+// published, either right away or by the scheduler once ScheduledFor has
+// passed. Archived posts are hidden again but keep their PublishedAt.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
 type Post struct {
 	ID               uint           `json:"id" gorm:"primaryKey"`
 	Title            string         `json:"title" gorm:"not null"`
 	Description      string         `json:"description" gorm:"not null"`
 	Content          string         `json:"content" gorm:"not null"`
-	UserID           uint           `json:"user_id" gorm:"not null"`
+	UserID           uint           `json:"user_id" gorm:"not null;uniqueIndex:idx_posts_user_slug,priority:1,where:deleted_at IS NULL;index:idx_posts_user_status,priority:1"`
 	User             User           `json:"user" gorm:"foreignKey:UserID"`
 	Category         string         `json:"category" gorm:"not null"`
 	Tags             pq.StringArray `json:"tags" gorm:"type:text[]"`
-	Slug             string         `json:"slug" gorm:"not null"`
+	Slug             string         `json:"slug" gorm:"not null;uniqueIndex:idx_posts_user_slug,priority:2"`
 	FeaturedImage    string         `json:"featured_image"`
 	FeaturedImageUrl string         `json:"featuredImage_url"`
-	Status           string         `json:"status" gorm:"not null;default:draft"`
+	Status           string         `json:"status" gorm:"not null;default:draft;index;index:idx_posts_user_status,priority:2"`
+	PublishedAt      *time.Time     `json:"published_at"`
+	ScheduledFor     *time.Time     `json:"scheduled_for" gorm:"index"`
 	ViewCount        uint           `json:"view_count" gorm:"not null;default:0"`
-	CreatedAt        time.Time      `json:"created_at"`
+	LikesCount       int            `json:"likes_count" gorm:"not null;default:0"`
+	DislikesCount    int            `json:"dislikes_count" gorm:"not null;default:0"`
+	CommentsCount    int            `json:"comments_count" gorm:"not null;default:0"`
+	CreatedAt        time.Time      `json:"created_at" gorm:"index"`
 	DeletedAt        gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 	Comments         []Comment
 	LikesandDislikes []LikesandDislikes
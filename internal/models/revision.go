@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostRevision is a snapshot of a post's text as saved by one edit. Revisions
+// are numbered per post from 1, the version the post was created with, and
+// are never changed afterwards. RestoredFrom is set when the edit restored
+// an older revision.
+type PostRevision struct {
+	ID           uint           `json:"-" gorm:"primaryKey"`
+	PostID       uint           `json:"-" gorm:"not null;uniqueIndex:idx_post_revision_number"`
+	Number       int            `json:"number" gorm:"not null;uniqueIndex:idx_post_revision_number"`
+	Title        string         `json:"title" gorm:"not null"`
+	Description  string         `json:"description" gorm:"not null"`
+	Content      string         `json:"content" gorm:"not null"`
+	Tags         pq.StringArray `json:"tags" gorm:"type:text[]"`
+	EditorID     uint           `json:"-" gorm:"not null"`
+	Editor       User           `json:"-" gorm:"foreignKey:EditorID"`
+	RestoredFrom *int           `json:"restored_from"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
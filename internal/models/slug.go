@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PostSlugHistory records a slug a post used to have, so that links using it
+// can be redirected to the current one.
+type PostSlugHistory struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	PostID    uint      `json:"-" gorm:"not null;index"`
+	Slug      string    `json:"slug" gorm:"not null;index"`
+	ChangedAt time.Time `json:"changed_at" gorm:"not null"`
+}
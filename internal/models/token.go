@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID  string     `json:"family_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Session is one logged in device. Its ID is shared by the refresh token
+// family issued at login and carried as the sid claim of access tokens.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;index"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+type SigningKey struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Kid        string    `json:"kid" gorm:"uniqueIndex;not null"`
+	Algorithm  string    `json:"algorithm" gorm:"not null"`
+	PrivateKey string    `json:"-" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+const (
+	EmailVerificationToken = "email_verification"
+	PasswordResetToken     = "password_reset"
+	AccountUnlockToken     = "account_unlock"
+	MFAChallengeToken      = "mfa_challenge"
+)
+
+// UserToken is a single-use token mailed to a user, or an MFA challenge handed
+// out at login. Only its hash is stored.
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a one-time code that can stand in for a TOTP code when the
+// user has lost their authenticator.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access
+// tokens rather than JWTs.
+const PersonalAccessTokenPrefix = "bpat_"
+
+// PersonalAccessToken is a long-lived, scoped credential for scripts and
+// integrations. Only its hash is stored; Prefix is kept so users can tell
+// their tokens apart.
+type PersonalAccessToken struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	UserID     uint           `json:"user_id" gorm:"not null;index"`
+	Name       string         `json:"name" gorm:"not null"`
+	Prefix     string         `json:"prefix" gorm:"not null"`
+	TokenHash  string         `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     pq.StringArray `json:"scopes" gorm:"type:text[]"`
+	ExpiresAt  *time.Time     `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+	RevokedAt  *time.Time     `json:"revoked_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
@@ -6,21 +6,59 @@ import (
 	"gorm.io/gorm"
 )
 
+// User is never serialized as-is; handlers go through the views in
+// handlers/user_views.go. Private fields are still hidden here so that a
+// User embedded in another model, such as Post.User, can't leak them.
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Username  string         `json:"username" gorm:"uniqueIndex;not null"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	Bio       string         `json:"bio"`
-	AvatarURL string         `json:"avatar_url"`
-	Followers []*User        `json:"followers" gorm:"many2many:user_followers;joinForeignKey:following_id;joinReferences:follower_id"`
-	Following []*User        `json:"following" gorm:"many2many:user_followers;joinForeignKey:follower_id;joinReferences:following_id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Username        string         `json:"username" gorm:"uniqueIndex;not null"`
+	Email           string         `json:"-" gorm:"uniqueIndex;not null"`
+	Password        string         `json:"-" gorm:"not null"`
+	Role            string         `json:"-" gorm:"not null;default:author"`
+	EmailVerifiedAt *time.Time     `json:"-"`
+	TOTPSecret      string         `json:"-"`
+	TOTPEnabledAt   *time.Time     `json:"-"`
+	TOTPLastStep    int64          `json:"-"`
+	FirebaseUID     *string        `json:"-" gorm:"uniqueIndex"`
+	DisplayName     string         `json:"display_name"`
+	Bio             string         `json:"bio"`
+	Location        string         `json:"location"`
+	Website         string         `json:"website"`
+	Pronouns        string         `json:"pronouns"`
+	AvatarURL       string         `json:"avatar_url"`
+	CoverImageURL   string         `json:"cover_image_url"`
+	IsPrivate       bool           `json:"is_private" gorm:"not null;default:false"`
+	ShowEmail       bool           `json:"-" gorm:"not null;default:false"`
+	FollowersCount  int            `json:"followers_count" gorm:"not null;default:0"`
+	FollowingCount  int            `json:"following_count" gorm:"not null;default:0"`
+	PostsCount      int            `json:"posts_count" gorm:"not null;default:0"`
+	Followers       []*User        `json:"-" gorm:"many2many:user_followers;joinForeignKey:following_id;joinReferences:follower_id"`
+	Following       []*User        `json:"-" gorm:"many2many:user_followers;joinForeignKey:follower_id;joinReferences:following_id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"-"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
-	Posts            []Post             `json:"posts" gorm:"foreignKey:UserID"`
-	Comments         []Comment          `json:"comments" gorm:"foreignKey:UserID"`
-	LikesandDislikes []LikesandDislikes `json:"likesanddislikes" gorm:"foreignKey:UserID"`
-	Bookmarks        []Bookmark         `json:"bookmarks" gorm:"foreignKey:UserID"`
+	Posts            []Post             `json:"-" gorm:"foreignKey:UserID"`
+	Comments         []Comment          `json:"-" gorm:"foreignKey:UserID"`
+	LikesandDislikes []LikesandDislikes `json:"-" gorm:"foreignKey:UserID"`
+	Bookmarks        []Bookmark         `json:"-" gorm:"foreignKey:UserID"`
+	SocialLinks      []SocialLink       `json:"-" gorm:"foreignKey:UserID"`
 }
+
+// SocialLink is a link to one of the user's accounts elsewhere. It is
+// verified once the linked page links back to the profile with rel="me".
+type SocialLink struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;uniqueIndex:idx_social_link_user_url"`
+	URL        string     `json:"url" gorm:"not null;uniqueIndex:idx_social_link_user_url"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	CheckedAt  *time.Time `json:"checked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleReader = "reader"
+)
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// UsernameHistory records a username a user has given up. Until
+// ReservedUntil nobody else can take it, and while nobody has, links using
+// it are redirected to the user's current name.
+type UsernameHistory struct {
+	ID            uint      `json:"-" gorm:"primaryKey"`
+	UserID        uint      `json:"-" gorm:"not null;index"`
+	Username      string    `json:"username" gorm:"not null;index"`
+	ReservedUntil time.Time `json:"reserved_until" gorm:"not null"`
+	ChangedAt     time.Time `json:"changed_at" gorm:"not null"`
+}
@@ -0,0 +1,79 @@
+package policy
+
+import "github.com-Personal/go-fiber/internal/models"
+
+type Permission string
+
+const (
+	PostsCreate       Permission = "posts:create"
+	PostsEditAny      Permission = "posts:edit_any"
+	PostsDeleteAny    Permission = "posts:delete_any"
+	CommentsCreate    Permission = "comments:create"
+	CommentsDeleteAny Permission = "comments:delete_any"
+	UsersManage       Permission = "users:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleAdmin: {
+		PostsCreate, PostsEditAny, PostsDeleteAny,
+		CommentsCreate, CommentsDeleteAny,
+		UsersManage,
+	},
+	models.RoleEditor: {
+		PostsCreate, PostsEditAny,
+		CommentsCreate, CommentsDeleteAny,
+	},
+	models.RoleAuthor: {
+		PostsCreate,
+		CommentsCreate,
+	},
+	models.RoleReader: {
+		CommentsCreate,
+	},
+}
+
+// sensitive permissions are re-checked against the database instead of
+// trusting the role embedded in the access token, so a demotion takes effect
+// immediately.
+var sensitive = map[Permission]bool{
+	PostsEditAny:      true,
+	PostsDeleteAny:    true,
+	CommentsDeleteAny: true,
+	UsersManage:       true,
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func IsSensitive(permission Permission) bool {
+	return sensitive[permission]
+}
+
+func CanEditPost(role string, userID uint, post models.Post) bool {
+	return post.UserID == userID || HasPermission(role, PostsEditAny)
+}
+
+func CanDeletePost(role string, userID uint, post models.Post) bool {
+	return post.UserID == userID || HasPermission(role, PostsDeleteAny)
+}
+
+// CanEditComment only allows the author to change what a comment says;
+// moderators can remove comments but not put words in someone's mouth.
+func CanEditComment(role string, userID uint, comment models.Comment) bool {
+	return comment.UserID == userID
+}
+
+func CanDeleteComment(role string, userID uint, comment models.Comment) bool {
+	return comment.UserID == userID || HasPermission(role, CommentsDeleteAny)
+}
@@ -0,0 +1,32 @@
+package policy
+
+// Scopes limit what a personal access token can do. Sessions started with a
+// password are not scoped.
+const (
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsRead  = "comments:read"
+	ScopeCommentsWrite = "comments:write"
+	ScopeProfileRead   = "profile:read"
+)
+
+var scopes = map[string]bool{
+	ScopePostsRead:     true,
+	ScopePostsWrite:    true,
+	ScopeCommentsRead:  true,
+	ScopeCommentsWrite: true,
+	ScopeProfileRead:   true,
+}
+
+func ValidScope(scope string) bool {
+	return scopes[scope]
+}
+
+func HasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
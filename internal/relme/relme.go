@@ -0,0 +1,205 @@
+// Package relme checks that a page links back to a profile with rel="me",
+// which is how a user proves that a link on their profile is theirs.
+package relme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// maxPageSize caps how much of a page is read while looking for links.
+const maxPageSize = 1 << 20
+
+// ErrBlockedAddress is returned for pages on loopback, private or otherwise
+// non-public addresses, so verification can't be used to probe the internal
+// network.
+var ErrBlockedAddress = errors.New("relme: address is not publicly routable")
+
+// Fetcher retrieves the page behind a link. HTTPFetcher is the real one;
+// tests can substitute their own.
+type Fetcher interface {
+	Fetch(ctx context.Context, pageURL string) (io.ReadCloser, error)
+}
+
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher returns a fetcher that only connects to public addresses
+// and gives up after ten seconds.
+func NewHTTPFetcher() *HTTPFetcher {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	return &HTTPFetcher{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+			},
+		},
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, pageURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "go-fiber-blog rel-me verifier")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("relme: %s returned %s", pageURL, resp.Status)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxPageSize), resp.Body}, nil
+}
+
+// reservedNetworks are special-purpose ranges the net.IP predicates don't
+// cover: "this network", carrier-grade NAT shared address space, IETF
+// protocol assignments, benchmarking and the reserved class E range.
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(net.ParseIP(host)) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify fetches pageURL and reports whether it has an <a> or <link> with
+// rel="me" pointing at profileURL.
+func Verify(ctx context.Context, f Fetcher, pageURL, profileURL string) (bool, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return false, err
+	}
+
+	page, err := f.Fetch(ctx, pageURL)
+	if err != nil {
+		return false, err
+	}
+	defer page.Close()
+
+	links, err := Links(page, base)
+	if err != nil {
+		return false, err
+	}
+
+	want := normalize(profileURL)
+	for _, link := range links {
+		if normalize(link) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Links returns the targets of the rel="me" links on a page, resolved
+// against base.
+func Links(r io.Reader, base *url.URL) ([]string, error) {
+	var links []string
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return links, nil
+			}
+			return links, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data != "a" && token.Data != "link" {
+				continue
+			}
+
+			var href string
+			isMe := false
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "href":
+					href = attr.Val
+				case "rel":
+					for _, rel := range strings.Fields(attr.Val) {
+						if strings.EqualFold(rel, "me") {
+							isMe = true
+						}
+					}
+				}
+			}
+			if !isMe || href == "" {
+				continue
+			}
+			if target, err := base.Parse(href); err == nil {
+				links = append(links, target.String())
+			}
+		}
+	}
+}
+
+// normalize makes URLs that differ only in case of the host, a trailing
+// slash or a fragment compare equal.
+func normalize(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
@@ -0,0 +1,158 @@
+package relme
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	page := `<html><head>
+		<link rel="me" href="https://blog.example/users/alice">
+		<link rel="stylesheet" href="/style.css">
+	</head><body>
+		<a rel="ME" href="/about">About</a>
+		<a rel="nofollow me noopener" href="https://other.example/@alice#top">Elsewhere</a>
+		<a rel="met" href="https://not.example/1">Not me</a>
+		<a rel="author" href="https://not.example/2">Author</a>
+		<a rel="me">No href</a>
+		<a href="https://not.example/3">No rel</a>
+		<span rel="me" href="https://not.example/4">Not a link</span>
+		<a rel="me" href="../profile/">Relative</a>
+	</body></html>`
+	base, _ := url.Parse("https://social.example/people/alice/posts")
+
+	links, err := Links(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"https://blog.example/users/alice",
+		"https://social.example/about",
+		"https://other.example/@alice#top",
+		"https://social.example/people/profile/",
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Fatalf("Links() = %q, want %q", links, want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"https://Blog.Example/users/alice", "https://blog.example/users/alice"},
+		{"HTTPS://blog.example/users/alice/", "https://blog.example/users/alice"},
+		{"https://blog.example/users/alice#posts", "https://blog.example/users/alice"},
+		{" https://blog.example/users/alice ", "https://blog.example/users/alice"},
+	}
+	for _, tt := range tests {
+		if normalize(tt.a) != normalize(tt.b) {
+			t.Errorf("normalize(%q) = %q, want it to equal normalize(%q) = %q", tt.a, normalize(tt.a), tt.b, normalize(tt.b))
+		}
+	}
+
+	if normalize("https://blog.example/users/Alice") == normalize("https://blog.example/users/alice") {
+		t.Error("paths should stay case sensitive")
+	}
+	if normalize("http://blog.example/users/alice") == normalize("https://blog.example/users/alice") {
+		t.Error("schemes should not be conflated")
+	}
+}
+
+// stubFetcher serves fixed pages.
+type stubFetcher map[string]string
+
+func (f stubFetcher) Fetch(ctx context.Context, pageURL string) (io.ReadCloser, error) {
+	page, ok := f[pageURL]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return io.NopCloser(strings.NewReader(page)), nil
+}
+
+func TestVerify(t *testing.T) {
+	fetcher := stubFetcher{
+		"https://social.example/@alice": `<a rel="me" href="https://BLOG.example/users/alice/">My blog</a>`,
+		"https://social.example/@bob":   `<a href="https://blog.example/users/bob">No rel</a>`,
+		"https://social.example/@carol": `<a rel="me" href="https://blog.example/users/alice">Someone else</a>`,
+		"https://blog.example/carol":    `<link rel="me" href="/users/carol">`,
+	}
+
+	tests := []struct {
+		page, profile string
+		want          bool
+	}{
+		{"https://social.example/@alice", "https://blog.example/users/alice", true},
+		{"https://social.example/@bob", "https://blog.example/users/bob", false},
+		{"https://social.example/@carol", "https://blog.example/users/carol", false},
+		{"https://blog.example/carol", "https://blog.example/users/carol", true},
+	}
+	for _, tt := range tests {
+		got, err := Verify(context.Background(), fetcher, tt.page, tt.profile)
+		if err != nil {
+			t.Fatalf("Verify(%s): %v", tt.page, err)
+		}
+		if got != tt.want {
+			t.Errorf("Verify(%s, %s) = %v, want %v", tt.page, tt.profile, got, tt.want)
+		}
+	}
+
+	if _, err := Verify(context.Background(), fetcher, "https://social.example/@nobody", "https://blog.example/users/nobody"); err == nil {
+		t.Error("Verify should fail when the page can't be fetched")
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"100.63.255.255", true},
+		{"100.128.0.1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPFetcherRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the fetcher connected to a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch() error = %v, want ErrBlockedAddress", err)
+	}
+}
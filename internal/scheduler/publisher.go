@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"gorm.io/gorm"
+)
+
+// publishBatchSize caps how many posts one statement publishes, so a backlog
+// doesn't hold row locks for long.
+const publishBatchSize = 100
+
+// PostPublisher publishes scheduled posts once they are due. Several API
+// instances can run one each: every due post is claimed by exactly one of
+// them.
+type PostPublisher struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewPostPublisher(db *gorm.DB, interval time.Duration) *PostPublisher {
+	return &PostPublisher{db: db, interval: interval}
+}
+
+// Start publishes due posts right away, to catch up on anything that came
+// due while no instance was running, and then every interval until stop is
+// closed.
+func (p *PostPublisher) Start(stop <-chan struct{}) {
+	go func() {
+		p.run()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.run()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (p *PostPublisher) run() {
+	published, err := p.PublishDue(time.Now())
+	if err != nil {
+		log.Printf("publishing scheduled posts failed: %v", err)
+	}
+	if published > 0 {
+		log.Printf("published %d scheduled posts", published)
+	}
+}
+
+// PublishDue publishes the posts scheduled for now or earlier and returns how
+// many it published. Each post's PublishedAt is the time it was scheduled
+// for. Rows another instance is publishing are skipped rather than waited
+// for, and the status check is repeated on the locked row, so no post is
+// published twice. Authors' posts counts go up in the same transaction.
+func (p *PostPublisher) PublishDue(now time.Time) (int64, error) {
+	var total int64
+	for {
+		var authors []uint
+		err := p.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Raw(`UPDATE posts SET status = ?, published_at = scheduled_for, scheduled_for = NULL
+				WHERE status = ? AND id IN (
+					SELECT id FROM posts
+					WHERE status = ? AND scheduled_for <= ? AND deleted_at IS NULL
+					ORDER BY scheduled_for
+					LIMIT ?
+					FOR UPDATE SKIP LOCKED
+				)
+				RETURNING user_id`,
+				models.PostPublished, models.PostScheduled, models.PostScheduled, now, publishBatchSize).
+				Scan(&authors).Error
+			if err != nil {
+				return err
+			}
+			return countPublished(tx, authors)
+		})
+		if err != nil {
+			return total, err
+		}
+		total += int64(len(authors))
+		if len(authors) < publishBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// countPublished adds one to the posts count of the author of each newly
+// published post. Authors are updated in ID order so that instances
+// publishing at the same time don't deadlock.
+func countPublished(tx *gorm.DB, authors []uint) error {
+	published := map[uint]int{}
+	for _, id := range authors {
+		published[id]++
+	}
+	ids := make([]uint, 0, len(published))
+	for id := range published {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		err := tx.Model(&models.User{}).Where("id = ?", id).
+			UpdateColumn("posts_count", gorm.Expr("posts_count + ?", published[id])).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
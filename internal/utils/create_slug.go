@@ -1,46 +1,69 @@
 package utils
 
 import (
-	"errors"
-	"regexp"
+	"fmt"
 	"strings"
+	"unicode"
+)
+
+const (
+	// MaxSlugLength is the longest slug CreateSlug returns, in characters.
+	MaxSlugLength = 80
 
-	"github.com/golang-jwt/jwt/v5"
+	// fallbackSlug is used for titles with no letters or digits at all.
+	fallbackSlug = "post"
 )
 
+// CreateSlug turns a title into a lowercase, hyphen separated slug. Latin,
+// Greek, Cyrillic, Devanagari and kana are transliterated to ASCII; letters
+// of other scripts, such as kanji, are kept as they are, so no title ends up
+// with an empty slug.
 func CreateSlug(input string) string {
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
-	if err != nil {
-		panic(err)
+	var sb strings.Builder
+	hyphen := false
+	kept := false
+	for _, r := range strings.ToLower(transliterate(input)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		case kept && unicode.Is(unicode.M, r):
+			// Combining marks belong to the letter before them.
+		default:
+			hyphen = sb.Len() > 0
+			kept = false
+			continue
+		}
+		if hyphen {
+			sb.WriteByte('-')
+			hyphen = false
+		}
+		sb.WriteRune(r)
+		kept = true
 	}
-	processedString := reg.ReplaceAllString(input, " ")
-
-	processedString = strings.TrimSpace(processedString)
-
-	slug := strings.ReplaceAll(processedString, " ", "-")
-
-	slug = strings.ToLower(slug)
 
+	slug := truncateSlug(sb.String(), MaxSlugLength)
+	if slug == "" {
+		return fallbackSlug
+	}
 	return slug
 }
 
-func ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(GetSecretOrEnv("JWT_SECRET_KEY")), nil
-	})
+// NumberedSlug appends -n to slug, shortening slug if needed to stay within
+// MaxSlugLength.
+func NumberedSlug(slug string, n int) string {
+	suffix := fmt.Sprintf("-%d", n)
+	return truncateSlug(slug, MaxSlugLength-len(suffix)) + suffix
+}
 
-	if err != nil || !token.Valid {
-		return nil, err
+// truncateSlug cuts slug to at most max characters, at a hyphen when there
+// is one to cut at.
+func truncateSlug(slug string, max int) string {
+	runes := []rune(slug)
+	if len(runes) <= max {
+		return slug
 	}
-
-	if token.Method.Alg() != jwt.SigningMethodHS256.Name {
-		return nil, errors.New("invalid token signing method")
+	cut := string(runes[:max])
+	if i := strings.LastIndexByte(cut, '-'); i > 0 {
+		cut = cut[:i]
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
-	}
-
-	return claims, nil
+	return strings.Trim(cut, "-")
 }
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCreateSlug(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go   1.22 -- what's new?  ", "go-1-22-what-s-new"},
+		{"Crème Brûlée", "creme-brulee"},
+		{"Straße", "strasse"},
+		{"Привет, мир!", "privet-mir"},
+		{"Ελληνικά", "ellinika"},
+		{"नमस्ते दुनिया", "namaste-duniya"},
+		{"हिंदी में ब्लॉग", "hindi-men-blog"},
+		{"カタカナ", "katakana"},
+		{"こんにちは世界", "konnichiha-世界"},
+		{"日本語", "日本語"},
+		{"!!!", "post"},
+	}
+	for _, tt := range tests {
+		if got := CreateSlug(tt.title); got != tt.want {
+			t.Errorf("CreateSlug(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSlugLength(t *testing.T) {
+	tests := []struct {
+		name, title string
+	}{
+		{"words", strings.Repeat("word ", 30)},
+		{"one long word", strings.Repeat("abcdefghij", 10)},
+		{"kanji", strings.Repeat("日本語", 40)},
+	}
+	for _, tt := range tests {
+		slug := CreateSlug(tt.title)
+		if n := utf8.RuneCountInString(slug); n > MaxSlugLength || n == 0 {
+			t.Errorf("%s: CreateSlug gave %d characters, want 1 to %d", tt.name, n, MaxSlugLength)
+		}
+		if strings.HasPrefix(slug, "-") || strings.HasSuffix(slug, "-") {
+			t.Errorf("%s: CreateSlug(%q) = %q has a stray hyphen", tt.name, tt.title, slug)
+		}
+
+		for _, n := range []int{2, 999} {
+			numbered := NumberedSlug(slug, n)
+			if utf8.RuneCountInString(numbered) > MaxSlugLength {
+				t.Errorf("%s: NumberedSlug(%q, %d) = %q is longer than %d characters", tt.name, slug, n, numbered, MaxSlugLength)
+			}
+		}
+	}
+
+	// Words are kept whole when there is a hyphen to cut at.
+	if got := CreateSlug(strings.Repeat("word ", 30)); got != strings.TrimSuffix(strings.Repeat("word-", 16), "-") {
+		t.Errorf("CreateSlug cut a word: %q", got)
+	}
+	if got := NumberedSlug("my-post", 2); got != "my-post-2" {
+		t.Errorf("NumberedSlug(my-post, 2) = %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+package firebase_utils
+
+import (
+	"context"
+
+	"firebase.google.com/go/auth"
+)
+
+// Identity is what this API needs to know about a verified Firebase user.
+type Identity struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Provider      string
+}
+
+// TokenVerifier verifies Firebase ID tokens. It is an interface so tests can
+// substitute a fake for the Firebase Auth client.
+type TokenVerifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*Identity, error)
+}
+
+type AuthClientVerifier struct {
+	Client *auth.Client
+}
+
+func NewAuthClientVerifier(client *auth.Client) *AuthClientVerifier {
+	return &AuthClientVerifier{Client: client}
+}
+
+func (v *AuthClientVerifier) VerifyIDToken(ctx context.Context, idToken string) (*Identity, error) {
+	token, err := v.Client.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		UID:      token.UID,
+		Provider: token.Firebase.SignInProvider,
+	}
+	identity.Email, _ = token.Claims["email"].(string)
+	identity.EmailVerified, _ = token.Claims["email_verified"].(bool)
+	identity.Name, _ = token.Claims["name"].(string)
+	identity.Picture, _ = token.Claims["picture"].(string)
+
+	return identity, nil
+}
@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com-Personal/go-fiber/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// keyRotationLock is the Postgres advisory lock id held while a new signing
+// key is generated, so that several API instances don't rotate at once.
+const keyRotationLock = 7310421
+
+// keyReloadInterval limits how often an unknown kid can force a reload of the
+// key set from the database.
+const keyReloadInterval = 30 * time.Second
+
+// JWKSMaxAge is how long verifiers may cache the JWKS. A new key is
+// published this long before it starts signing, so that every cached copy
+// of the key set has it by the time tokens signed with it turn up.
+const JWKSMaxAge = 5 * time.Minute
+
+type signingKey struct {
+	kid       string
+	alg       string
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+}
+
+// KeyRing holds the asymmetric keys used to sign and verify tokens. Keys are
+// stored in the database so every instance signs with the same current key
+// and publishes the same JWKS. The newest key that has been published for
+// JWKSMaxAge signs; older keys are kept for verification until every token
+// they could have signed has expired.
+type KeyRing struct {
+	db        *gorm.DB
+	alg       string
+	rotation  time.Duration
+	retention time.Duration
+
+	mu         sync.RWMutex
+	keys       []signingKey
+	lastReload time.Time
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var keyRing *KeyRing
+
+// SetKeyRing switches token signing from the shared HS256 secret to the keys
+// held by k.
+func SetKeyRing(k *KeyRing) {
+	keyRing = k
+}
+
+func NewKeyRing(db *gorm.DB, alg string, rotation, retention time.Duration) (*KeyRing, error) {
+	if alg != jwt.SigningMethodRS256.Alg() && alg != jwt.SigningMethodEdDSA.Alg() {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if rotation <= 0 {
+		return nil, errors.New("key rotation interval must be positive")
+	}
+
+	k := &KeyRing{
+		db:        db,
+		alg:       alg,
+		rotation:  rotation,
+		retention: retention,
+	}
+	if err := k.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// RotationCheckInterval is how often a key ring rotating keys every
+// rotation checks whether it is time for a new key, and so how late a
+// rotation can be.
+func RotationCheckInterval(rotation time.Duration) time.Duration {
+	interval := rotation / 10
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	return interval
+}
+
+// Start reloads the key set and rotates the signing key on a schedule until
+// stop is closed.
+func (k *KeyRing) Start(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(RotationCheckInterval(k.rotation))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.Rotate(); err != nil {
+					log.Printf("signing key rotation failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Rotate generates a new signing key when the newest one is older than the
+// rotation interval, then reloads the key set. The new key is published
+// right away but only signs once JWKSMaxAge has passed.
+func (k *KeyRing) Rotate() error {
+	err := k.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", keyRotationLock).Error; err != nil {
+			return err
+		}
+
+		var newest models.SigningKey
+		err := tx.Where("algorithm = ?", k.alg).Order("created_at DESC").First(&newest).Error
+		if err == nil && time.Since(newest.CreatedAt) < k.rotation {
+			return nil
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		record, err := generateSigningKey(k.alg)
+		if err != nil {
+			return err
+		}
+		log.Printf("generated new %s signing key %s", record.Algorithm, record.Kid)
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+func (k *KeyRing) reload() error {
+	var records []models.SigningKey
+	cutoff := time.Now().Add(-(k.rotation + k.retention))
+	err := k.db.Where("algorithm = ? AND created_at > ?", k.alg, cutoff).
+		Order("created_at DESC").
+		Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	keys := make([]signingKey, 0, len(records))
+	for _, record := range records {
+		key, err := parseSigningKey(record)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
+
+// current returns the newest key that has been published long enough to be
+// in every cached JWKS. Until there is one, as on first start, the oldest
+// key signs.
+func (k *KeyRing) current() (signingKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return signingKey{}, errors.New("no signing key available")
+	}
+	published := time.Now().Add(-JWKSMaxAge)
+	for _, key := range k.keys {
+		if !key.createdAt.After(published) {
+			return key, nil
+		}
+	}
+	return k.keys[len(k.keys)-1], nil
+}
+
+// publicKey looks up a verification key by kid, reloading the key set once if
+// the kid is unknown so keys rotated in by another instance are picked up.
+func (k *KeyRing) publicKey(kid string) (crypto.PublicKey, error) {
+	if key, ok := k.find(kid); ok {
+		return key.public, nil
+	}
+
+	k.mu.RLock()
+	stale := time.Since(k.lastReload) > keyReloadInterval
+	k.mu.RUnlock()
+
+	if stale {
+		if err := k.reload(); err != nil {
+			return nil, err
+		}
+		if key, ok := k.find(kid); ok {
+			return key.public, nil
+		}
+	}
+
+	return nil, errors.New("unknown signing key")
+}
+
+func (k *KeyRing) find(kid string) (signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.kid == kid {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// JWKS returns the public half of every key that may still have signed a
+// valid token, and of the key about to take over signing.
+func (k *KeyRing) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if k == nil {
+		return jwks
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		jwk := JWK{Use: "sig", Alg: key.alg, Kid: key.kid}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+func generateSigningKey(alg string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		Kid:        uuid.NewString(),
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parseSigningKey(record models.SigningKey) (signingKey, error) {
+	block, _ := pem.Decode([]byte(record.PrivateKey))
+	if block == nil {
+		return signingKey{}, fmt.Errorf("signing key %s is not valid PEM", record.Kid)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("parsing signing key %s: %w", record.Kid, err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("signing key %s cannot sign", record.Kid)
+	}
+
+	return signingKey{
+		kid:       record.Kid,
+		alg:       record.Algorithm,
+		private:   private,
+		public:    private.Public(),
+		createdAt: record.CreatedAt,
+	}, nil
+}
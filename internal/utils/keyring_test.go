@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyRingSignsWithPublishedKey(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		keys  []signingKey
+		wants string
+	}{
+		{
+			name: "new key not yet in cached key sets",
+			keys: []signingKey{
+				{kid: "next", createdAt: now.Add(-time.Minute)},
+				{kid: "current", createdAt: now.Add(-30 * 24 * time.Hour)},
+			},
+			wants: "current",
+		},
+		{
+			name: "new key published long enough",
+			keys: []signingKey{
+				{kid: "next", createdAt: now.Add(-JWKSMaxAge - time.Second)},
+				{kid: "current", createdAt: now.Add(-30 * 24 * time.Hour)},
+			},
+			wants: "next",
+		},
+		{
+			name:  "only key, just generated",
+			keys:  []signingKey{{kid: "first", createdAt: now}},
+			wants: "first",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &KeyRing{keys: tt.keys}
+			key, err := k.current()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.kid != tt.wants {
+				t.Fatalf("signing with %s, want %s", key.kid, tt.wants)
+			}
+		})
+	}
+
+	if _, err := (&KeyRing{}).current(); err == nil {
+		t.Fatal("an empty key ring should have no signing key")
+	}
+}
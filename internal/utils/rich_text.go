@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// richTextTags are the elements kept by SanitizeRichText. Other elements are
+// dropped but their text is kept.
+var richTextTags = map[string]bool{
+	"p": true, "br": true, "strong": true, "em": true, "b": true, "i": true,
+	"u": true, "s": true, "a": true, "ul": true, "ol": true, "li": true,
+	"blockquote": true, "code": true,
+}
+
+// droppedTags are removed together with everything inside them.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"template": true, "noscript": true,
+}
+
+// SanitizeRichText reduces user-written HTML to a small set of formatting
+// tags without attributes, except http, https and mailto links. Unclosed
+// tags are closed and stray end tags are dropped.
+func SanitizeRichText(input string) string {
+	var b strings.Builder
+	var open []string
+	skipping := ""
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF, or input the tokenizer can't make sense of; either
+			// way what has been written so far is safe.
+			break
+		}
+		token := z.Token()
+
+		if skipping != "" {
+			if tt == html.EndTagToken && token.Data == skipping {
+				skipping = ""
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(token.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[token.Data] {
+				if tt == html.StartTagToken {
+					skipping = token.Data
+				}
+				continue
+			}
+			if !richTextTags[token.Data] {
+				continue
+			}
+			if token.Data == "br" {
+				b.WriteString("<br>")
+				continue
+			}
+			b.WriteString(openingTag(token))
+			if tt == html.StartTagToken {
+				open = append(open, token.Data)
+			} else {
+				b.WriteString("</" + token.Data + ">")
+			}
+		case html.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != token.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func openingTag(token html.Token) string {
+	if token.Data != "a" {
+		return "<" + token.Data + ">"
+	}
+
+	for _, attr := range token.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+		target, err := url.Parse(strings.TrimSpace(attr.Val))
+		if err != nil {
+			break
+		}
+		switch strings.ToLower(target.Scheme) {
+		case "http", "https", "mailto":
+			return `<a href="` + html.EscapeString(target.String()) + `" rel="nofollow noopener ugc">`
+		}
+		break
+	}
+	return "<a>"
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	MFAToken     = "mfa"
+
+	TokenIssuer = "go-fiber-blog-api"
+
+	// RefreshTokenTTL is how long refresh tokens last, the longest of any
+	// token, so signing keys have to stay verifiable at least this long
+	// after they stop signing.
+	RefreshTokenTTL = time.Hour * 24 * 7
+)
+
+// tokenAudiences keeps access and refresh tokens from being accepted in each
+// other's place even if the typ claim were ignored by a verifier.
+var tokenAudiences = map[string]string{
+	AccessToken:  "blog-api",
+	RefreshToken: "blog-api/refresh",
+	MFAToken:     "blog-api/mfa",
+}
+
+type TokenClaims struct {
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Type      string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func GenerateToken(userID uint, username, role, sessionID, tokenType string, expiration time.Duration) (string, error) {
+	audience, ok := tokenAudiences[tokenType]
+	if !ok {
+		return "", errors.New("unknown token type: " + tokenType)
+	}
+
+	now := time.Now()
+	claims := TokenClaims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		Type:      tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Subject:   username,
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+	}
+
+	if keyRing == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(GetSecretOrEnv("JWT_SECRET_KEY")))
+	}
+
+	key, err := keyRing.current()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.alg), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keyRing == nil {
+		return []byte(GetSecretOrEnv("JWT_SECRET_KEY")), nil
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("missing kid header")
+	}
+	return keyRing.publicKey(kid)
+}
+
+func validMethods() []string {
+	if keyRing == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+	return []string{keyRing.alg}
+}
+
+// ValidateToken verifies the signature and registered claims of a token and
+// rejects it unless it is of the expected type.
+func ValidateToken(tokenString, tokenType string) (*TokenClaims, error) {
+	audience, ok := tokenAudiences[tokenType]
+	if !ok {
+		return nil, errors.New("unknown token type: " + tokenType)
+	}
+
+	claims := &TokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods(validMethods()),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.Type != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+
+	return claims, nil
+}
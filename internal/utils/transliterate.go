@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// letterTransliterations covers lowercase letters that don't reduce to ASCII
+// by dropping accents: special Latin letters, Greek and Cyrillic.
+var letterTransliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ł': "l", 'ı': "i", 'ħ': "h", 'ŋ': "ng", 'ſ': "s",
+
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+}
+
+// transliterate rewrites s in ASCII where it knows how, leaving everything
+// else, including punctuation, as it is.
+func transliterate(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case isDevanagari(r):
+			end := i + runLength(s[i:], isDevanagari)
+			sb.WriteString(transliterateDevanagari(s[i:end]))
+			i = end
+			continue
+		case isKana(r):
+			// Japanese doesn't space words, so the romaji is set apart
+			// from any kanji around it.
+			end := i + runLength(s[i:], isKana)
+			sb.WriteString(" " + transliterateKana(s[i:end]) + " ")
+			i = end
+			continue
+		}
+		sb.WriteString(transliterateLetter(r))
+		i += size
+	}
+	return sb.String()
+}
+
+func runLength(s string, in func(rune) bool) int {
+	for i, r := range s {
+		if !in(r) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// transliterateLetter looks r up, or drops its accents if what is left is
+// ASCII, as for é or ﬁ.
+func transliterateLetter(r rune) string {
+	lower := unicode.ToLower(r)
+	if ascii, ok := letterTransliterations[lower]; ok {
+		return ascii
+	}
+	if lower < utf8.RuneSelf {
+		return string(r)
+	}
+
+	var base strings.Builder
+	for _, d := range norm.NFKD.String(string(lower)) {
+		if unicode.Is(unicode.Mn, d) {
+			continue
+		}
+		if ascii, ok := letterTransliterations[d]; ok {
+			base.WriteString(ascii)
+			continue
+		}
+		if d >= utf8.RuneSelf {
+			return string(r)
+		}
+		base.WriteRune(d)
+	}
+	return base.String()
+}
+
+// Devanagari consonants carry an inherent a, which a vowel sign replaces and
+// a virama removes.
+var (
+	devanagariConsonants = map[rune]string{
+		'क': "k", 'ख': "kh", 'ग': "g", 'घ': "gh", 'ङ': "n",
+		'च': "ch", 'छ': "chh", 'ज': "j", 'झ': "jh", 'ञ': "n",
+		'ट': "t", 'ठ': "th", 'ड': "d", 'ढ': "dh", 'ण': "n",
+		'त': "t", 'थ': "th", 'द': "d", 'ध': "dh", 'न': "n", 'ऩ': "n",
+		'प': "p", 'फ': "ph", 'ब': "b", 'भ': "bh", 'म': "m",
+		'य': "y", 'र': "r", 'ऱ': "r", 'ल': "l", 'ळ': "l", 'ऴ': "l", 'व': "v",
+		'श': "sh", 'ष': "sh", 'स': "s", 'ह': "h",
+	}
+	// NFC spells the consonants with a nukta as two runes.
+	devanagariNuktaConsonants = map[rune]string{
+		'क': "q", 'ख': "kh", 'ग': "g", 'ज': "z", 'ड': "r", 'ढ': "rh", 'फ': "f", 'य': "y",
+	}
+	devanagariVowels = map[rune]string{
+		'अ': "a", 'आ': "a", 'इ': "i", 'ई': "i", 'उ': "u", 'ऊ': "u", 'ऋ': "ri",
+		'ए': "e", 'ऐ': "ai", 'ओ': "o", 'औ': "au", 'ऑ': "o", 'ॐ': "om",
+	}
+	devanagariVowelSigns = map[rune]string{
+		'ा': "a", 'ि': "i", 'ी': "i", 'ु': "u", 'ू': "u", 'ृ': "ri",
+		'े': "e", 'ै': "ai", 'ो': "o", 'ौ': "au", 'ॉ': "o",
+	}
+	devanagariSigns = map[rune]string{
+		'ं': "n", 'ँ': "n", 'ः': "h",
+	}
+)
+
+const (
+	devanagariVirama = '्'
+	devanagariNukta  = '़'
+)
+
+// isDevanagari reports whether r is a Devanagari letter, sign or digit. The
+// dandas are left out: they end sentences, like a full stop.
+func isDevanagari(r rune) bool {
+	return r >= 0x0900 && r <= 0x097F && r != '।' && r != '॥'
+}
+
+// transliterateDevanagari romanizes a run of Devanagari the way Hindi is
+// commonly written in Latin letters, dropping the inherent a at the end of
+// words of more than one syllable.
+func transliterateDevanagari(s string) string {
+	runes := []rune(norm.NFC.String(s))
+	var sb strings.Builder
+	syllables := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if consonant, ok := devanagariConsonants[r]; ok {
+			next := i + 1
+			if next < len(runes) && runes[next] == devanagariNukta {
+				if nukta, ok := devanagariNuktaConsonants[r]; ok {
+					consonant = nukta
+				}
+				next++
+			}
+			sb.WriteString(consonant)
+			switch {
+			case next < len(runes) && runes[next] == devanagariVirama:
+				next++
+			case next < len(runes) && devanagariVowelSigns[runes[next]] != "":
+				sb.WriteString(devanagariVowelSigns[runes[next]])
+				next++
+				syllables++
+			case next < len(runes) && isDevanagariLetter(runes[next]), syllables == 0:
+				sb.WriteString("a")
+				syllables++
+			}
+			i = next - 1
+			continue
+		}
+
+		switch {
+		case devanagariVowels[r] != "":
+			sb.WriteString(devanagariVowels[r])
+			syllables++
+		case devanagariSigns[r] != "":
+			sb.WriteString(devanagariSigns[r])
+		case r >= '०' && r <= '९':
+			sb.WriteRune('0' + r - '०')
+			syllables = 0
+		}
+	}
+	return sb.String()
+}
+
+func isDevanagariLetter(r rune) bool {
+	_, consonant := devanagariConsonants[r]
+	_, vowel := devanagariVowels[r]
+	_, sign := devanagariSigns[r]
+	return consonant || vowel || sign
+}
+
+// kana maps hiragana to Hepburn romaji. Katakana is looked up through the
+// matching hiragana.
+var kana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゎ': "wa",
+}
+
+const (
+	smallTsu       = 'っ'
+	prolongedSound = 'ー'
+)
+
+// isKana reports whether r is hiragana or katakana, including the prolonged
+// sound mark but not the middle dot that separates words.
+func isKana(r rune) bool {
+	return (r >= 0x3041 && r <= 0x3096) || (r >= 0x30A1 && r <= 0x30FA) || r == prolongedSound
+}
+
+// transliterateKana romanizes a run of kana: small ya, yu and yo combine
+// with the kana before them, small vowels replace its vowel, a small tsu
+// doubles the next consonant and the prolonged sound mark is dropped.
+func transliterateKana(s string) string {
+	out := ""
+	double := false
+	for _, r := range s {
+		if r >= 0x30A1 && r <= 0x30F6 {
+			r -= 0x60 // katakana to hiragana
+		}
+
+		switch r {
+		case prolongedSound:
+			continue
+		case smallTsu:
+			double = true
+			continue
+		case 'ゃ', 'ゅ', 'ょ':
+			out = palatalize(out, kana[r+1])
+			continue
+		case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ':
+			out = replaceVowel(out, kana[r])
+			continue
+		}
+
+		romaji, ok := kana[r]
+		if !ok {
+			continue
+		}
+		if double && !strings.ContainsRune("aiueon", rune(romaji[0])) {
+			out += romaji[:1]
+		}
+		double = false
+		out += romaji
+	}
+	return out
+}
+
+// palatalize appends ya, yu or yo to out, turning ki + ya into kya and
+// shi + ya into sha.
+func palatalize(out, y string) string {
+	if !strings.HasSuffix(out, "i") {
+		return out + y
+	}
+	out = strings.TrimSuffix(out, "i")
+	if strings.HasSuffix(out, "sh") || strings.HasSuffix(out, "ch") || strings.HasSuffix(out, "j") {
+		return out + y[1:]
+	}
+	return out + y
+}
+
+// replaceVowel appends a small vowel to out in place of its last vowel,
+// turning fu + a into fa and te + i into ti.
+func replaceVowel(out, vowel string) string {
+	if out != "" && strings.ContainsAny(out[len(out)-1:], "aiueo") {
+		out = out[:len(out)-1]
+	}
+	return out + vowel
+}